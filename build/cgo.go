@@ -0,0 +1,185 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"container/vector"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CgoDirectives holds the flags given by #cgo directives in the preamble of a
+// file that imports "C".
+type CgoDirectives struct {
+	CFlags  []string
+	LDFlags []string
+}
+
+// ParseCgoDirectives finds the #cgo directives in the preamble of the supplied
+// .go file, which set flags for the C compiler and linker:
+//
+//	// #cgo CFLAGS: -I/usr/local/include -DNDEBUG
+//	// #cgo linux LDFLAGS: -lm
+//	// #cgo darwin/amd64 LDFLAGS: -framework CoreFoundation
+//	import "C"
+//
+// The preamble ends at the import of "C", which may also be part of a group,
+// with directives in the comment preceding it within the group. The flags are given in the form accepted by SplitArgs. A directive may be
+// restricted to particular targets by listing OSes, architectures, or OS/arch
+// pairs before the flag name, in which case it applies if any of them matches
+// the supplied OS and architecture.
+//
+// Also returned is a copy of the source with the directives blanked out, which
+// cgo can process without passing them on to the C compiler. Line numbers are
+// preserved.
+func ParseCgoDirectives(
+	source string,
+	goos string,
+	goarch string) (directives CgoDirectives, stripped string, err os.Error) {
+	var cflags vector.StringVector
+	var ldflags vector.StringVector
+	var result vector.StringVector
+
+	lineNum := 0
+	inPreamble := true
+	for source != "" {
+		end := strings.Index(source, "\n") + 1
+		if end == 0 {
+			end = len(source)
+		}
+
+		line := source[0:end]
+		source = source[end:]
+		lineNum++
+
+		trimmed := strings.TrimSpace(line)
+		if importsC(trimmed) {
+			inPreamble = false
+		}
+
+		if strings.HasPrefix(trimmed, "//") {
+			trimmed = strings.TrimSpace(trimmed[2:])
+		}
+
+		if !inPreamble || !isCgoDirective(trimmed) {
+			result.Push(line)
+			continue
+		}
+
+		name, args, applies, parseErr := parseCgoDirective(trimmed, goos, goarch)
+		if parseErr != nil {
+			err = os.NewError(fmt.Sprintf("line %d: %s", lineNum, parseErr))
+			return
+		}
+
+		if applies && name == "CFLAGS" {
+			cflags.AppendVector(&args)
+		} else if applies {
+			ldflags.AppendVector(&args)
+		}
+
+		if strings.HasSuffix(line, "\n") {
+			result.Push("\n")
+		}
+	}
+
+	directives.CFlags = cflags.Data()
+	directives.LDFlags = ldflags.Data()
+	stripped = strings.Join(result.Data(), "")
+	return
+}
+
+// importsC returns true if the supplied line, minus surrounding space, imports
+// "C", either on its own or within a group:
+//
+//	import "C"
+//	import ("C")
+//	import (
+//		"C"
+//	)
+func importsC(line string) bool {
+	if strings.HasPrefix(line, "import") {
+		line = strings.TrimSpace(line[len("import"):])
+		if strings.HasPrefix(line, "(") {
+			line = strings.TrimSpace(line[1:])
+		}
+	}
+
+	if !strings.HasPrefix(line, `"C"`) {
+		return false
+	}
+
+	rest := strings.TrimSpace(line[len(`"C"`):])
+	return rest == "" ||
+		strings.HasPrefix(rest, ")") ||
+		strings.HasPrefix(rest, ";") ||
+		strings.HasPrefix(rest, "//")
+}
+
+func isCgoDirective(line string) bool {
+	return strings.HasPrefix(line, "#cgo ") || strings.HasPrefix(line, "#cgo\t")
+}
+
+// parseCgoDirective parses a single #cgo directive, returning the name of the
+// flag it sets, its arguments, and whether it applies to the supplied target.
+func parseCgoDirective(
+	line string,
+	goos string,
+	goarch string) (name string, args []string, applies bool, err os.Error) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		err = os.NewError("Malformed #cgo directive: " + line)
+		return
+	}
+
+	words, err := SplitArgs(line[len("#cgo"):colon])
+	if err != nil {
+		return
+	}
+
+	if len(words) == 0 {
+		err = os.NewError("Malformed #cgo directive: " + line)
+		return
+	}
+
+	name = words[len(words)-1]
+	if name != "CFLAGS" && name != "LDFLAGS" {
+		err = os.NewError("Unsupported #cgo flag: " + name)
+		return
+	}
+
+	args, err = SplitArgs(line[colon+1:])
+	if err != nil {
+		return
+	}
+
+	constraints := words[0 : len(words)-1]
+	applies = len(constraints) == 0
+	for _, constraint := range constraints {
+		if matchesConstraint(constraint, goos, goarch) {
+			applies = true
+		}
+	}
+
+	return
+}
+
+// matchesConstraint returns true if the supplied OS, architecture, or OS/arch
+// pair matches the target.
+func matchesConstraint(constraint string, goos string, goarch string) bool {
+	if slash := strings.Index(constraint, "/"); slash >= 0 {
+		return matchesValue(constraint[0:slash], goos) &&
+			matchesValue(constraint[slash+1:], goarch)
+	}
+
+	switch {
+	case knownOSes[constraint]:
+		return matchesValue(constraint, goos)
+	case knownArches[constraint]:
+		return matchesValue(constraint, goarch)
+	}
+
+	return false
+}
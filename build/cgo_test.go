@@ -0,0 +1,148 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"reflect"
+	"testing"
+)
+
+func expectArgsEqual(t *testing.T, expected []string, actual []string) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected: %v\nGot: %v", expected, actual)
+	}
+}
+
+func TestParseCgoDirectivesNoDirectives(t *testing.T) {
+	source := "package foo\n\n// #include <stdio.h>\nimport \"C\"\n"
+
+	directives, stripped, err := ParseCgoDirectives(source, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("ParseCgoDirectives: %s", err)
+	}
+
+	expectArgsEqual(t, []string{}, directives.CFlags)
+	expectArgsEqual(t, []string{}, directives.LDFlags)
+	expectEqual(t, source, stripped)
+}
+
+func TestParseCgoDirectives(t *testing.T) {
+	source := `package foo
+
+// #cgo CFLAGS: -I/usr/local/include -DNAME='a b'
+// #cgo LDFLAGS: -lm
+// #cgo darwin LDFLAGS: -framework Foundation
+// #cgo linux/amd64 386 CFLAGS: -DLINUX
+// #include <math.h>
+import "C"
+
+// #cgo LDFLAGS: -lignored
+func Foo() {}
+`
+
+	expectedStripped := `package foo
+
+
+
+
+
+// #include <math.h>
+import "C"
+
+// #cgo LDFLAGS: -lignored
+func Foo() {}
+`
+
+	directives, stripped, err := ParseCgoDirectives(source, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("ParseCgoDirectives: %s", err)
+	}
+
+	expectArgsEqual(
+		t,
+		[]string{"-I/usr/local/include", "-DNAME=a b", "-DLINUX"},
+		directives.CFlags)
+	expectArgsEqual(t, []string{"-lm"}, directives.LDFlags)
+	expectEqual(t, expectedStripped, stripped)
+}
+
+func TestParseCgoDirectivesBlockComment(t *testing.T) {
+	source := "package foo\n\n/*\n#cgo LDFLAGS: -lz\n#include <zlib.h>\n*/\nimport \"C\"\n"
+
+	directives, stripped, err := ParseCgoDirectives(source, "darwin", "386")
+	if err != nil {
+		t.Fatalf("ParseCgoDirectives: %s", err)
+	}
+
+	expectArgsEqual(t, []string{"-lz"}, directives.LDFlags)
+	expectEqual(t, "package foo\n\n/*\n\n#include <zlib.h>\n*/\nimport \"C\"\n", stripped)
+}
+
+func TestParseCgoDirectivesGroupedImport(t *testing.T) {
+	source := `package foo
+
+// #cgo LDFLAGS: -lm
+import (
+	"fmt"
+
+	// #cgo CFLAGS: -DFOO
+	// #include <math.h>
+	"C"
+
+	// #cgo LDFLAGS: -lignored
+	"os"
+)
+`
+
+	expectedStripped := `package foo
+
+
+import (
+	"fmt"
+
+
+	// #include <math.h>
+	"C"
+
+	// #cgo LDFLAGS: -lignored
+	"os"
+)
+`
+
+	directives, stripped, err := ParseCgoDirectives(source, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("ParseCgoDirectives: %s", err)
+	}
+
+	expectArgsEqual(t, []string{"-DFOO"}, directives.CFlags)
+	expectArgsEqual(t, []string{"-lm"}, directives.LDFlags)
+	expectEqual(t, expectedStripped, stripped)
+}
+
+func TestParseCgoDirectivesSingleLineGroup(t *testing.T) {
+	source := "package foo\n\n// #cgo LDFLAGS: -lm\nimport ( \"C\" )\n\n// #cgo LDFLAGS: -lz\n"
+
+	directives, _, err := ParseCgoDirectives(source, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("ParseCgoDirectives: %s", err)
+	}
+
+	expectArgsEqual(t, []string{"-lm"}, directives.LDFlags)
+}
+
+func TestParseCgoDirectivesErrors(t *testing.T) {
+	sources := []string{
+		"// #cgo CFLAGS -I/tmp\nimport \"C\"\n",
+		"// #cgo :\nimport \"C\"\n",
+		"// #cgo CPPFLAGS: -I/tmp\nimport \"C\"\n",
+		"// #cgo CFLAGS: '-I/tmp\nimport \"C\"\n",
+	}
+
+	for _, source := range sources {
+		_, _, err := ParseCgoDirectives(source, "linux", "amd64")
+		if err == nil {
+			t.Errorf("Expected an error for: %s", source)
+		}
+	}
+}
@@ -5,11 +5,13 @@
 package build
 
 import (
+	"container/vector"
+	"fmt"
 	"igo/parse"
 	"igo/set"
-	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 	"strings"
 )
 
@@ -21,6 +23,17 @@ type DirectoryInfo struct {
 	Files *set.StringSet
 	Deps  *set.StringSet
 
+	// Assembly (.s) files to be assembled and packed into the package's archive.
+	AsmFiles *set.StringSet
+
+	// .go files that import "C", and so must be processed by cgo before being
+	// compiled.
+	CgoFiles *set.StringSet
+
+	// C (.c) files to be built with the system C compiler along with the output
+	// of cgo. They are ignored if there are no cgo files.
+	CFiles *set.StringSet
+
 	// .go files and their local dependencies necessary for building the package
 	// tests, in addition to the ones above.
 	TestFiles *set.StringSet
@@ -28,39 +41,131 @@ type DirectoryInfo struct {
 
 	// Names of test functions within the package.
 	TestFuncs *set.StringSet
+
+	// Import paths, other than relative ones, that refer to packages within the
+	// project, mapped to the names of those packages. These include imports
+	// using the import prefix and of vendored packages. See ImportConfig.
+	ResolvedImports map[string]string
+
+	// Imports of packages within the project that the compiler can't find as
+	// written, such as "../foo" or "./foo/../bar", mapped to the equivalent
+	// relative import from the project root ("./bar"). The package's .go files
+	// must be compiled with these imports rewritten; see parse.RewriteImports.
+	RewrittenImports map[string]string
+
+	// The imports of packages outside the project, such as those of the
+	// standard library, in order of file and position. Imports of packages
+	// that have no archive, such as "unsafe", are omitted.
+	ExternalImports []parse.Import
+
+	// Problems with the package's imports, such as relative imports that escape
+	// the project root, prefixed with the position of the import.
+	Errors *vector.StringVector
 }
 
 // GetDirectoryInfo scans the supplied directory, determining what package it
-// represents (see below), what .go files it contains (test and non-test), and
-// what their local package dependencies are.
+// represents (see below), what .go, .s and .c files it contains (test and
+// non-test), and what their local package dependencies are.
+//
+// Files whose names end in an OS or architecture, such as foo_linux.go or
+// foo_linux_amd64.s, are ignored unless they match the target given by $GOOS
+// and $GOARCH. See MatchesTarget.
 //
 // Sub-directories are not traversed. It is assumed that all of the .go files
 // in the directory (not including its sub-directories) belong to the same
 // package.
+//
+// Directories named testdata, and their sub-directories, hold data for tests
+// rather than packages, so they are treated as containing no .go files.
+//
+// Only relative imports, such as "./foo", and imports of packages in vendor
+// directories are treated as local dependencies. See ImportConfig.ResolveImport
+// for how they are resolved, and ImportConfig.GetDirectoryInfo for other
+// import paths.
 func GetDirectoryInfo(dir string) DirectoryInfo {
+	var config ImportConfig
+	return config.GetDirectoryInfo(dir)
+}
+
+// GetDirectoryInfo is like the package-level GetDirectoryInfo, but finds the
+// local dependencies of the directory's package according to the config. See
+// ImportConfig.ResolveImport. dir must be within the config's root.
+func (c *ImportConfig) GetDirectoryInfo(dir string) DirectoryInfo {
 	var visitor directoryInfoVisitor
 	visitor.originalDir = dir
+	visitor.config = c
+	visitor.resolvedImports = make(map[string]string)
+	visitor.rewrittenImports = make(map[string]string)
+
+	visitor.packageDir = path.Clean(dir)
+	if c.Root != "" {
+		visitor.packageDir = RelativePath(c.Root, dir)
+	}
+
+	if !IsTestdataDir(dir) {
+		path.Walk(dir, &visitor, nil)
+	}
+
+	sort.Sort(&visitor.externalImports)
+	externalImports := make([]parse.Import, visitor.externalImports.Len())
+	for i := range externalImports {
+		externalImports[i] = visitor.externalImports.At(i).(parse.Import)
+	}
 
-	path.Walk(dir, &visitor, nil)
 	return DirectoryInfo{
 		visitor.packageName,
 		&visitor.files,
 		&visitor.deps,
+		&visitor.asmFiles,
+		&visitor.cgoFiles,
+		&visitor.cFiles,
 		&visitor.testFiles,
 		&visitor.testDeps,
 		&visitor.testFuncs,
+		visitor.resolvedImports,
+		visitor.rewrittenImports,
+		externalImports,
+		&visitor.errors,
 	}
 }
 
 type directoryInfoVisitor struct {
 	originalDir string // The directory supplied by the user.
+	packageDir  string // The same directory, relative to the project root.
+	config      *ImportConfig
 
 	packageName string
 	files       set.StringSet
 	deps        set.StringSet
+	asmFiles    set.StringSet
+	cgoFiles    set.StringSet
+	cFiles      set.StringSet
 	testFiles   set.StringSet
 	testDeps    set.StringSet
 	testFuncs   set.StringSet
+
+	resolvedImports  map[string]string
+	rewrittenImports map[string]string
+	externalImports  importList
+	errors           vector.StringVector
+}
+
+// importList is a list of parse.Imports sortable by file and position.
+type importList struct {
+	vector.Vector
+}
+
+func (l *importList) Less(i, j int) bool {
+	a := l.At(i).(parse.Import)
+	b := l.At(j).(parse.Import)
+	switch {
+	case a.File != b.File:
+		return a.File < b.File
+	case a.Line != b.Line:
+		return a.Line < b.Line
+	}
+
+	return a.Column < b.Column
 }
 
 func (v *directoryInfoVisitor) VisitDir(dir string, d *os.Dir) bool {
@@ -68,13 +173,35 @@ func (v *directoryInfoVisitor) VisitDir(dir string, d *os.Dir) bool {
 	return dir == v.originalDir
 }
 
+// Import paths that don't refer to archives: "C" is handled by cgo, and
+// "unsafe" is built into the compiler.
+var builtinImports = map[string]bool{
+	"C":      true,
+	"unsafe": true,
+}
+
 func (v *directoryInfoVisitor) VisitFile(file string, d *os.Dir) {
-	// Ignore files that aren't Go source.
-	if path.Ext(file) != ".go" {
+	// Ignore files that aren't Go, assembly or C source, or are for another
+	// target.
+	ext := path.Ext(file)
+	if ext != ".go" && ext != ".s" && ext != ".c" {
+		return
+	}
+
+	if !MatchesTarget(file, os.Getenv("GOOS"), os.Getenv("GOARCH")) {
 		return
 	}
 
-	// Is this a normal source file or a test file?
+	switch ext {
+	case ".s":
+		v.asmFiles.Insert(file)
+		return
+	case ".c":
+		v.cFiles.Insert(file)
+		return
+	}
+
+	// Is this a normal source file, a cgo file, or a test file?
 	files := &v.files
 	deps := &v.deps
 	isTest := strings.HasSuffix(file, "_test.go")
@@ -83,22 +210,112 @@ func (v *directoryInfoVisitor) VisitFile(file string, d *os.Dir) {
 		deps = &v.testDeps
 	}
 
-	files.Insert(file)
-
-	contents, err := ioutil.ReadFile(file)
+	info, err := v.config.FileCache.GetFileInfo(file)
 	if err == nil {
-		for dep := range parse.GetImports(string(contents)).Iter() {
-			if strings.HasPrefix(dep, "./") {
-				deps.Insert(dep[2:])
+		for _, record := range info.Imports {
+			if !isTest && record.Path == "C" {
+				files = &v.cgoFiles
+			}
+		}
+
+		for _, record := range info.Imports {
+			dep := record.Path
+			packageName, ok, err := v.config.ResolveImport(v.packageDir, dep)
+			switch {
+			case err != nil:
+				v.errors.Push(fmt.Sprintf("%s:%d: %s", file, record.Line, err))
+			case ok:
+				deps.Insert(packageName)
+				switch {
+				case dep == "./"+packageName:
+					// The compiler finds the archive as written.
+				case strings.HasPrefix(dep, ".") || path.Clean(dep) != dep:
+					v.rewrittenImports[dep] = "./" + packageName
+				default:
+					v.resolvedImports[dep] = packageName
+				}
+			case !builtinImports[dep]:
+				v.externalImports.Push(record)
 			}
 		}
 
 		if v.packageName == "" {
-			v.packageName = parse.GetPackageName(string(contents))
+			v.packageName = info.PackageName
 		}
 	}
 
+	files.Insert(file)
+
 	if isTest {
-		v.testFuncs.Union(parse.GetTestFunctions(string(contents)))
+		for _, name := range info.TestFuncs {
+			v.testFuncs.Insert(name)
+		}
 	}
 }
+
+// IsTestdataDir returns true if dir is a directory named testdata or is within
+// one.
+func IsTestdataDir(dir string) bool {
+	dir = path.Clean(dir)
+	return dir == "testdata" ||
+		strings.HasPrefix(dir, "testdata/") ||
+		strings.HasSuffix(dir, "/testdata") ||
+		strings.Index(dir, "/testdata/") >= 0
+}
+
+var knownOSes = map[string]bool{
+	"darwin":  true,
+	"freebsd": true,
+	"linux":   true,
+	"nacl":    true,
+	"windows": true,
+}
+
+var knownArches = map[string]bool{
+	"386":   true,
+	"amd64": true,
+	"arm":   true,
+}
+
+// MatchesTarget returns true if the supplied source file should be built for
+// the supplied OS and architecture, according to its name. A file whose name
+// (minus any _test suffix) ends in _GOOS, _GOARCH, or _GOOS_GOARCH for a known
+// OS or architecture is built only for that target. All other files are built
+// for every target. An empty goos or goarch matches any OS or architecture.
+func MatchesTarget(file string, goos string, goarch string) bool {
+	_, name := path.Split(file)
+	name = name[0 : len(name)-len(path.Ext(name))]
+	if strings.HasSuffix(name, "_test") {
+		name = name[0 : len(name)-len("_test")]
+	}
+
+	// Find the last two underscore-separated components of the name. The first
+	// component can't be a constraint, since foo_linux.go is for linux but
+	// linux.go is for every target.
+	last := ""
+	secondLast := ""
+	if index := strings.LastIndex(name, "_"); index >= 0 {
+		last = name[index+1:]
+		name = name[0:index]
+		if index := strings.LastIndex(name, "_"); index >= 0 {
+			secondLast = name[index+1:]
+		}
+	}
+
+	switch {
+	case knownOSes[secondLast] && knownArches[last]:
+		return matchesValue(secondLast, goos) && matchesValue(last, goarch)
+	case knownOSes[last]:
+		return matchesValue(last, goos)
+	case knownArches[last]:
+		return matchesValue(last, goarch)
+	}
+
+	return true
+}
+
+// matchesValue returns true if value is the wanted OS or architecture, or if
+// any is wanted.
+func matchesValue(value string, wanted string) bool {
+	return wanted == "" || value == wanted
+}
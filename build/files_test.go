@@ -6,6 +6,7 @@ package build
 import (
 	"container/vector"
 	"fmt"
+	"igo/parse"
 	"igo/set"
 	"once"
 	"os"
@@ -247,3 +248,209 @@ func TestIgnoresNonGoFile(t *testing.T) {
 	expectSetContents(t, []string{}, info.TestFiles)
 	expectSetContents(t, []string{}, info.TestDeps)
 }
+
+func TestIgnoresTestdataDir(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	testdata := path.Join(dir, "testdata")
+	err := os.Mkdir(testdata, 0700)
+	if err != nil {
+		panic(fmt.Sprintf("Can't create dir [%s]: %s", testdata, err))
+	}
+
+	file := createFile(testdata, "input.go")
+	defer file.Close()
+	writeFile(file, `
+		package blah
+		import "./foo"
+	`)
+
+	info := GetDirectoryInfo(testdata)
+	expectEqual(t, "", info.PackageName)
+	expectSetContents(t, []string{}, info.Files)
+	expectSetContents(t, []string{}, info.Deps)
+}
+
+func TestIsTestdataDir(t *testing.T) {
+	testdataDirs := []string{
+		"testdata",
+		"testdata/",
+		"foo/testdata",
+		"foo/testdata/bar",
+		"/tmp/foo/testdata",
+	}
+
+	otherDirs := []string{
+		"foo",
+		"foo/testdatas",
+		"mytestdata/foo",
+		"foo/bar_testdata",
+	}
+
+	for _, dir := range testdataDirs {
+		if !IsTestdataDir(dir) {
+			t.Errorf("Expected %s to be a testdata dir.", dir)
+		}
+	}
+
+	for _, dir := range otherDirs {
+		if IsTestdataDir(dir) {
+			t.Errorf("Expected %s not to be a testdata dir.", dir)
+		}
+	}
+}
+
+func TestAsmFiles(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	// Choose an OS other than the target for the file that should be ignored.
+	otherOS := "windows"
+	if os.Getenv("GOOS") == otherOS {
+		otherOS = "linux"
+	}
+
+	createFile(dir, "foo.go").Close()
+	createFile(dir, "hash.s").Close()
+	createFile(dir, "hash_"+otherOS+".s").Close()
+	createFile(dir, "hash_"+otherOS+".go").Close()
+	createFile(dir, "notes.txt").Close()
+
+	info := GetDirectoryInfo(dir)
+	expectSetContents(t, []string{path.Join(dir, "foo.go")}, info.Files)
+	expectSetContents(t, []string{path.Join(dir, "hash.s")}, info.AsmFiles)
+	expectSetContents(t, []string{}, info.TestFiles)
+}
+
+type targetCase struct {
+	file     string
+	goos     string
+	goarch   string
+	expected bool
+}
+
+func TestMatchesTarget(t *testing.T) {
+	cases := []targetCase{
+		targetCase{"foo.go", "linux", "amd64", true},
+		targetCase{"linux.go", "darwin", "amd64", true},
+		targetCase{"foo_bar.go", "linux", "amd64", true},
+		targetCase{"foo_linux.go", "linux", "amd64", true},
+		targetCase{"foo_linux.go", "darwin", "amd64", false},
+		targetCase{"foo_amd64.s", "linux", "amd64", true},
+		targetCase{"foo_amd64.s", "linux", "386", false},
+		targetCase{"foo_linux_amd64.s", "linux", "amd64", true},
+		targetCase{"foo_linux_amd64.s", "linux", "arm", false},
+		targetCase{"foo_linux_amd64.s", "darwin", "amd64", false},
+		targetCase{"foo_linux_test.go", "linux", "386", true},
+		targetCase{"foo_linux_test.go", "darwin", "386", false},
+		targetCase{"bar/foo_linux.go", "darwin", "386", false},
+		targetCase{"foo_linux.go", "", "", true},
+	}
+
+	for _, c := range cases {
+		result := MatchesTarget(c.file, c.goos, c.goarch)
+		if result != c.expected {
+			t.Errorf(
+				"MatchesTarget(%s, %s, %s): expected %v",
+				c.file,
+				c.goos,
+				c.goarch,
+				c.expected)
+		}
+	}
+}
+
+func TestCgoFiles(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	file := createFile(dir, "foo.go")
+	defer file.Close()
+	writeFile(file, `
+		package blah
+		import "./bar"
+	`)
+
+	cgoFile := createFile(dir, "wrapper.go")
+	defer cgoFile.Close()
+	writeFile(cgoFile, `
+		package blah
+		// #include <math.h>
+		import "C"
+		import "./baz"
+	`)
+
+	info := GetDirectoryInfo(dir)
+	expectSetContents(t, []string{path.Join(dir, "foo.go")}, info.Files)
+	expectSetContents(t, []string{path.Join(dir, "wrapper.go")}, info.CgoFiles)
+	expectSetContents(t, []string{"bar", "baz"}, info.Deps)
+}
+
+func TestCFiles(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	cgoFile := createFile(dir, "wrapper.go")
+	defer cgoFile.Close()
+	writeFile(cgoFile, `
+		package blah
+		// #include "wrapper.h"
+		import "C"
+	`)
+
+	header := createFile(dir, "wrapper.h")
+	defer header.Close()
+	writeFile(header, "int add(int a, int b);\n")
+
+	cFile := createFile(dir, "wrapper.c")
+	defer cFile.Close()
+	writeFile(cFile, "int add(int a, int b) { return a + b; }\n")
+
+	info := GetDirectoryInfo(dir)
+	expectSetContents(t, []string{path.Join(dir, "wrapper.go")}, info.CgoFiles)
+	expectSetContents(t, []string{path.Join(dir, "wrapper.c")}, info.CFiles)
+	expectSetContents(t, []string{}, info.Files)
+}
+
+func TestExternalImports(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	file := createFile(dir, "foo.go")
+	defer file.Close()
+	writeFile(file, "package blah\n\nimport (\n\t\"./bar\"\n\t\"fmt\"\n\t\"C\"\n\t\"htpp\"\n)\n")
+
+	testFile := createFile(dir, "foo_test.go")
+	defer testFile.Close()
+	writeFile(testFile, "package blah\n\nimport \"testing\"\n")
+
+	expected := []parse.Import{
+		parse.Import{"fmt", "", path.Join(dir, "foo.go"), 5, 2, false},
+		parse.Import{"htpp", "", path.Join(dir, "foo.go"), 7, 2, false},
+		parse.Import{"testing", "", path.Join(dir, "foo_test.go"), 3, 8, true},
+	}
+
+	info := GetDirectoryInfo(dir)
+	if !reflect.DeepEqual(expected, info.ExternalImports) {
+		t.Errorf("Expected: %v\nGot: %v", expected, info.ExternalImports)
+	}
+}
+
+func TestExternalImportsOmitsUnsafe(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	file := createFile(dir, "foo.go")
+	defer file.Close()
+	writeFile(file, "package blah\n\nimport (\n\t\"os\"\n\t\"unsafe\"\n)\n")
+
+	expected := []parse.Import{
+		parse.Import{"os", "", path.Join(dir, "foo.go"), 4, 2, false},
+	}
+
+	info := GetDirectoryInfo(dir)
+	if !reflect.DeepEqual(expected, info.ExternalImports) {
+		t.Errorf("Expected: %v\nGot: %v", expected, info.ExternalImports)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"container/vector"
+	"os"
+	"strings"
+)
+
+// ParseToolFlags parses the value of a flag such as -gcflags, which holds
+// arguments to be passed to a tool. The arguments may be preceded by a package
+// pattern and an equals sign, restricting them to the matching packages:
+//
+//	-N -I /tmp/include
+//	foo/...=-N
+//
+// The pattern is empty if there is none. See SplitArgs for the format of the
+// arguments.
+func ParseToolFlags(value string) (pattern string, args []string, err os.Error) {
+	value = strings.TrimSpace(value)
+
+	if !strings.HasPrefix(value, "-") {
+		if index := strings.Index(value, "="); index >= 0 {
+			pattern = value[0:index]
+			value = value[index+1:]
+		}
+	}
+
+	args, err = SplitArgs(value)
+	return
+}
+
+// SplitArgs splits a string into space-separated arguments. Single or double
+// quotes may be used to include spaces in an argument.
+func SplitArgs(s string) ([]string, os.Error) {
+	var result vector.StringVector
+
+	current := ""
+	inArg := false
+	var quote byte = 0
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			current += s[i : i+1]
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				result.Push(current)
+				current = ""
+				inArg = false
+			}
+		default:
+			current += s[i : i+1]
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, os.NewError("Unterminated quote in arguments: " + s)
+	}
+
+	if inArg {
+		result.Push(current)
+	}
+
+	return result.Data(), nil
+}
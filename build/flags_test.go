@@ -0,0 +1,78 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"reflect"
+	"testing"
+)
+
+type splitArgsCase struct {
+	input    string
+	expected []string
+}
+
+func TestSplitArgs(t *testing.T) {
+	cases := []splitArgsCase{
+		splitArgsCase{"", []string{}},
+		splitArgsCase{"   ", []string{}},
+		splitArgsCase{"-N", []string{"-N"}},
+		splitArgsCase{" -N  -I /tmp ", []string{"-N", "-I", "/tmp"}},
+		splitArgsCase{"-I '/tmp/foo bar'", []string{"-I", "/tmp/foo bar"}},
+		splitArgsCase{`-D "it's" ''`, []string{"-D", "it's", ""}},
+		splitArgsCase{`a"b c"d`, []string{"ab cd"}},
+	}
+
+	for _, c := range cases {
+		result, err := SplitArgs(c.input)
+		if err != nil {
+			t.Errorf("SplitArgs(%s): %s", c.input, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(c.expected, result) {
+			t.Errorf("SplitArgs(%s)\nExpected: %v\nGot: %v", c.input, c.expected, result)
+		}
+	}
+}
+
+func TestSplitArgsUnterminatedQuote(t *testing.T) {
+	_, err := SplitArgs("-I 'foo")
+	if err == nil {
+		t.Errorf("Expected an error.")
+	}
+}
+
+type toolFlagsCase struct {
+	input    string
+	pattern  string
+	expected []string
+}
+
+func TestParseToolFlags(t *testing.T) {
+	cases := []toolFlagsCase{
+		toolFlagsCase{"", "", []string{}},
+		toolFlagsCase{"-N", "", []string{"-N"}},
+		toolFlagsCase{"-D foo=bar", "", []string{"-D", "foo=bar"}},
+		toolFlagsCase{"foo=-N", "foo", []string{"-N"}},
+		toolFlagsCase{"foo/...=-N -I x", "foo/...", []string{"-N", "-I", "x"}},
+		toolFlagsCase{"...=", "...", []string{}},
+	}
+
+	for _, c := range cases {
+		pattern, args, err := ParseToolFlags(c.input)
+		if err != nil {
+			t.Errorf("ParseToolFlags(%s): %s", c.input, err)
+			continue
+		}
+
+		if pattern != c.pattern {
+			t.Errorf("ParseToolFlags(%s)\nExpected pattern: %s\nGot: %s", c.input, c.pattern, pattern)
+		}
+
+		if !reflect.DeepEqual(c.expected, args) {
+			t.Errorf("ParseToolFlags(%s)\nExpected: %v\nGot: %v", c.input, c.expected, args)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"fmt"
+	"igo/parse"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ModuleFile is the name of a file at the root of a project that declares the
+// project's import prefix, in a line of the form:
+//
+//	module igo
+//
+// Its presence also marks the root of the project, like RootMarkerFile.
+const ModuleFile = "go.mod"
+
+// ImportConfig describes how the import paths used within a project map to
+// the project's packages, and how the packages' source files are parsed.
+type ImportConfig struct {
+	// The project root, against which package names are resolved. If empty,
+	// the current directory is used.
+	Root string
+
+	// An import path of the form Prefix + "/foo" refers to the package in the
+	// directory foo within the project, just as "./foo" does. If Prefix is
+	// empty, only imports beginning with "./" refer to the project's packages.
+	Prefix string
+
+	// Directories within the project, relative to Root, that hold the source of
+	// third-party packages by import path. An import path that isn't found in a
+	// vendor directory (see ResolveImport) is looked for in each of these in
+	// turn.
+	SourceRoots []string
+
+	// Used to parse the source files of the project's packages. If nil, every
+	// file is parsed afresh.
+	FileCache *parse.FileCache
+}
+
+// VendorDir is the name of directories holding copies of third-party packages,
+// laid out by import path. See ImportConfig.ResolveImport.
+const VendorDir = "vendor"
+
+// LocalPackage returns the package within the project, named by its directory
+// relative to the project root, that the supplied import path refers to. dir is
+// the directory of the importing package, relative to the root. ok is false if
+// the import refers to a package outside the project.
+//
+// Imports beginning with "./" are resolved against the project root, just as
+// the compiler resolves them against the directory holding the compiled
+// packages, and those beginning with "../" against dir. Either way the result
+// is cleaned so that each package has a single name: "./foo/../bar" refers to
+// bar, as does "../bar" imported from foo. An error is returned for an import
+// that refers to the project root itself or escapes it.
+func (c *ImportConfig) LocalPackage(dir string, importPath string) (packageName string, ok bool, err os.Error) {
+	switch {
+	case strings.HasPrefix(importPath, "./"):
+		packageName = path.Clean(importPath)
+	case strings.HasPrefix(importPath, "../"):
+		packageName = path.Clean(dir + "/" + importPath)
+	case c.Prefix != "" && strings.HasPrefix(importPath, c.Prefix+"/"):
+		packageName = path.Clean(importPath[len(c.Prefix)+1:])
+	default:
+		return "", false, nil
+	}
+
+	switch {
+	case packageName == ".":
+		err = os.NewError(
+			fmt.Sprintf("Import %s refers to the project root, which can't be a package.",
+				strconv.Quote(importPath)))
+		return "", false, err
+
+	case packageName == ".." || strings.HasPrefix(packageName, "../"):
+		err = os.NewError(
+			fmt.Sprintf("Import %s escapes the project root.", strconv.Quote(importPath)))
+		return "", false, err
+	}
+
+	return packageName, true, nil
+}
+
+// ResolveImport is like LocalPackage, but also resolves imports of third-party
+// packages whose source is kept within the project. dir is the directory of the
+// importing package, relative to the project root.
+//
+// An import path such as "example.com/foo" that isn't local according to
+// LocalPackage is first looked for in the VendorDir of dir and each of its
+// ancestors up to the root, with the nearest winning, and then in each of the
+// source roots.
+func (c *ImportConfig) ResolveImport(dir string, importPath string) (packageName string, ok bool, err os.Error) {
+	packageName, ok, err = c.LocalPackage(dir, importPath)
+	if ok || err != nil {
+		return
+	}
+
+	// Imports of the form "./foo" and "../foo" have already been handled, and
+	// others containing "." or ".." components can't be looked up in a
+	// directory.
+	cleaned := path.Clean(importPath)
+	if cleaned != importPath || strings.HasPrefix(importPath, ".") || importPath == "C" {
+		return "", false, nil
+	}
+
+	for candidate := path.Clean(dir); ; candidate = parentPackage(candidate) {
+		vendored := path.Clean(candidate + "/" + VendorDir + "/" + importPath)
+		if c.isPackageDir(vendored) {
+			return vendored, true, nil
+		}
+
+		if candidate == "." || candidate == "/" {
+			break
+		}
+	}
+
+	for _, root := range c.SourceRoots {
+		found := path.Clean(root + "/" + importPath)
+		if c.isPackageDir(found) {
+			return found, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// SourceRootDir returns the supplied source root, given either relative to the
+// project root or as an absolute path, as a directory relative to the project
+// root, which must be absolute. An error is returned if the directory is
+// outside the project, since the compiler is given the paths of the files to
+// build relative to the root.
+func SourceRootDir(projectRoot string, sourceRoot string) (string, os.Error) {
+	dir := sourceRoot
+	if !strings.HasPrefix(dir, "/") {
+		dir = path.Join(projectRoot, dir)
+	}
+
+	result := RelativePath(projectRoot, dir)
+	if result == ".." || strings.HasPrefix(result, "../") {
+		err := os.NewError(
+			fmt.Sprintf("Source root %s is outside the project root %s.",
+				sourceRoot,
+				projectRoot))
+		return "", err
+	}
+
+	return result, nil
+}
+
+// parentPackage returns the parent of the supplied directory relative to the
+// project root, or "." if it is a top-level directory.
+func parentPackage(dir string) string {
+	parent, _ := path.Split(dir)
+	if parent == "" {
+		return "."
+	}
+
+	return path.Clean(parent)
+}
+
+// isPackageDir returns true if the supplied directory, relative to the root,
+// exists.
+func (c *ImportConfig) isPackageDir(dir string) bool {
+	if c.Root != "" {
+		dir = path.Join(c.Root, dir)
+	}
+
+	d, err := os.Stat(dir)
+	return err == nil && d.IsDirectory()
+}
+
+// ParseModuleFile returns the import prefix declared in the supplied contents
+// of a ModuleFile, or the empty string if there is none.
+func ParseModuleFile(contents string) string {
+	for contents != "" {
+		end := strings.Index(contents, "\n") + 1
+		if end == 0 {
+			end = len(contents)
+		}
+
+		line := strings.TrimSpace(contents[0:end])
+		contents = contents[end:]
+
+		if strings.HasPrefix(line, "module ") || strings.HasPrefix(line, "module\t") {
+			prefix := strings.TrimSpace(line[len("module"):])
+			if len(prefix) >= 2 && prefix[0] == '"' && prefix[len(prefix)-1] == '"' {
+				prefix = prefix[1 : len(prefix)-1]
+			}
+
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+// ReadImportPrefix returns the import prefix declared by the ModuleFile in the
+// supplied project root, or the empty string if there is no such file.
+func ReadImportPrefix(root string) (string, os.Error) {
+	name := path.Join(root, ModuleFile)
+	if !isFile(name) {
+		return "", nil
+	}
+
+	contents, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	return ParseModuleFile(string(contents)), nil
+}
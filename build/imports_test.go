@@ -0,0 +1,298 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type localPackageCase struct {
+	dir         string
+	importPath  string
+	packageName string
+	ok          bool
+}
+
+func TestLocalPackage(t *testing.T) {
+	config := ImportConfig{Prefix: "igo"}
+	cases := []localPackageCase{
+		localPackageCase{".", "./foo", "foo", true},
+		localPackageCase{".", "./foo/bar", "foo/bar", true},
+		localPackageCase{".", "./foo/../bar", "bar", true},
+		localPackageCase{".", "./foo//bar/./baz/", "foo/bar/baz", true},
+		localPackageCase{"a", "../foo/../bar/baz", "bar/baz", true},
+		localPackageCase{"a/b", "./foo", "foo", true},
+		localPackageCase{"a/b", "../foo", "a/foo", true},
+		localPackageCase{"a/b", "../../foo", "foo", true},
+		localPackageCase{".", "igo/foo", "foo", true},
+		localPackageCase{".", "igo/foo/bar", "foo/bar", true},
+		localPackageCase{".", "igo/foo/../bar", "bar", true},
+		localPackageCase{"a/b", "igo/foo", "foo", true},
+		localPackageCase{".", "igo", "", false},
+		localPackageCase{".", "igofoo/bar", "", false},
+		localPackageCase{".", "fmt", "", false},
+		localPackageCase{".", "container/vector", "", false},
+	}
+
+	for _, c := range cases {
+		packageName, ok, err := config.LocalPackage(c.dir, c.importPath)
+		if err != nil {
+			t.Errorf("LocalPackage(%s, %s): %s", c.dir, c.importPath, err)
+			continue
+		}
+
+		if packageName != c.packageName || ok != c.ok {
+			t.Errorf(
+				"LocalPackage(%s, %s): expected (%s, %v), got (%s, %v)",
+				c.dir,
+				c.importPath,
+				c.packageName,
+				c.ok,
+				packageName,
+				ok)
+		}
+	}
+}
+
+func TestLocalPackageNoPrefix(t *testing.T) {
+	var config ImportConfig
+	if _, ok, _ := config.LocalPackage(".", "igo/foo"); ok {
+		t.Errorf("Expected igo/foo not to be local.")
+	}
+
+	if packageName, _, _ := config.LocalPackage(".", "./foo"); packageName != "foo" {
+		t.Errorf("Expected foo, got %s", packageName)
+	}
+}
+
+func TestLocalPackageErrors(t *testing.T) {
+	config := ImportConfig{Prefix: "igo"}
+	cases := [][2]string{
+		[2]string{".", "./"},
+		[2]string{".", "./foo/.."},
+		[2]string{".", "../foo"},
+		[2]string{"a", "../../foo"},
+		[2]string{"a", "../a/.."},
+		[2]string{"a/b", "./foo/../../bar"},
+		[2]string{".", "igo/.."},
+		[2]string{".", "igo/../bar"},
+	}
+
+	for _, c := range cases {
+		_, ok, err := config.LocalPackage(c[0], c[1])
+		if err == nil || ok {
+			t.Errorf("Expected an error for %s imported from %s.", c[1], c[0])
+		}
+	}
+}
+
+func TestParseModuleFile(t *testing.T) {
+	expectEqual(t, "", ParseModuleFile(""))
+	expectEqual(t, "igo", ParseModuleFile("module igo\n"))
+	expectEqual(t, "igo", ParseModuleFile("module igo"))
+	expectEqual(t, "example.com/foo", ParseModuleFile("// Comment\n\nmodule \"example.com/foo\"\n\ngo 1.0\n"))
+	expectEqual(t, "", ParseModuleFile("modules igo\n"))
+}
+
+func TestReadImportPrefix(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	prefix, err := ReadImportPrefix(dir)
+	if err != nil || prefix != "" {
+		t.Errorf("Expected no prefix, got (%s, %v)", prefix, err)
+	}
+
+	file := createFile(dir, ModuleFile)
+	writeFile(file, "module igo\n")
+	file.Close()
+
+	prefix, err = ReadImportPrefix(dir)
+	if err != nil || prefix != "igo" {
+		t.Errorf("Expected igo, got (%s, %v)", prefix, err)
+	}
+}
+
+func TestGetDirectoryInfoWithImportPrefix(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	file := createFile(dir, "foo.go")
+	defer file.Close()
+	writeFile(file, `
+		package blah
+		import (
+			"./bar"
+			"igo/baz/qux"
+			"igofoo"
+			"fmt"
+		)
+	`)
+
+	testFile := createFile(dir, "foo_test.go")
+	defer testFile.Close()
+	writeFile(testFile, `
+		package blah
+		import "igo/asdf"
+	`)
+
+	config := ImportConfig{Prefix: "igo"}
+	info := config.GetDirectoryInfo(dir)
+	expectSetContents(t, []string{path.Join(dir, "foo.go")}, info.Files)
+	expectSetContents(t, []string{"bar", "baz/qux"}, info.Deps)
+	expectSetContents(t, []string{"asdf"}, info.TestDeps)
+}
+
+func TestGetDirectoryInfoRelativeImports(t *testing.T) {
+	root := createTempDir()
+	defer os.RemoveAll(root)
+
+	dir := createDir(root, "a/b")
+	file := createFile(dir, "foo.go")
+	defer file.Close()
+	writeFile(file, `
+		package blah
+		import (
+			"./baz"
+			"../qux"
+			"./bar/../baz"
+			"../../../asdf"
+			"igo/a/../baz"
+		)
+	`)
+
+	config := ImportConfig{Root: root, Prefix: "igo"}
+	info := config.GetDirectoryInfo(dir)
+	expectSetContents(t, []string{"baz", "a/qux"}, info.Deps)
+
+	expectedRewrites := map[string]string{
+		"../qux":       "./a/qux",
+		"./bar/../baz": "./baz",
+		"igo/a/../baz": "./baz",
+	}
+
+	if !reflect.DeepEqual(expectedRewrites, info.RewrittenImports) {
+		t.Errorf("Expected: %v\nGot: %v", expectedRewrites, info.RewrittenImports)
+	}
+
+	if info.Errors.Len() != 1 {
+		t.Fatalf("Expected one error, got: %v", info.Errors.Data())
+	}
+
+	if !strings.HasPrefix(info.Errors.At(0), path.Join(dir, "foo.go")+":7: ") {
+		t.Errorf("Expected the error to name foo.go:7, got: %s", info.Errors.At(0))
+	}
+}
+
+type resolveImportCase struct {
+	dir         string
+	importPath  string
+	packageName string
+	ok          bool
+}
+
+func TestResolveImport(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createDir(dir, "vendor/example.com/foo")
+	createDir(dir, "vendor/example.com/bar")
+	createDir(dir, "bar/vendor/example.com/foo")
+	createDir(dir, "bar/baz")
+	createDir(dir, "third_party/example.com/baz")
+	createDir(dir, "third_party/example.com/bar")
+
+	config := ImportConfig{dir, "igo", []string{"third_party"}}
+	cases := []resolveImportCase{
+		resolveImportCase{"bar/baz", "./qux", "qux", true},
+		resolveImportCase{"bar/baz", "igo/qux", "qux", true},
+		resolveImportCase{"bar/baz", "example.com/foo", "bar/vendor/example.com/foo", true},
+		resolveImportCase{"bar", "example.com/foo", "bar/vendor/example.com/foo", true},
+		resolveImportCase{"qux", "example.com/foo", "vendor/example.com/foo", true},
+		resolveImportCase{"bar/baz", "example.com/bar", "vendor/example.com/bar", true},
+		resolveImportCase{"bar/baz", "example.com/baz", "third_party/example.com/baz", true},
+		resolveImportCase{"bar/baz", "example.com/missing", "", false},
+		resolveImportCase{"bar/baz", "example.com//foo", "", false},
+		resolveImportCase{"bar/baz", "fmt", "", false},
+		resolveImportCase{"bar/baz", "C", "", false},
+	}
+
+	for _, c := range cases {
+		packageName, ok, err := config.ResolveImport(c.dir, c.importPath)
+		if err != nil {
+			t.Errorf("ResolveImport(%s, %s): %s", c.dir, c.importPath, err)
+			continue
+		}
+
+		if packageName != c.packageName || ok != c.ok {
+			t.Errorf(
+				"ResolveImport(%s, %s): expected (%s, %v), got (%s, %v)",
+				c.dir,
+				c.importPath,
+				c.packageName,
+				c.ok,
+				packageName,
+				ok)
+		}
+	}
+}
+
+func TestGetDirectoryInfoVendoredImports(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createDir(dir, "vendor/example.com/foo")
+	packageDir := createDir(dir, "bar")
+
+	file := createFile(packageDir, "bar.go")
+	defer file.Close()
+	writeFile(file, `
+		package bar
+		import (
+			"./baz"
+			"example.com/foo"
+			"igo/qux"
+			"fmt"
+		)
+	`)
+
+	config := ImportConfig{Root: dir, Prefix: "igo"}
+	info := config.GetDirectoryInfo(packageDir)
+	expectSetContents(t, []string{"baz", "qux", "vendor/example.com/foo"}, info.Deps)
+
+	expectedImports := map[string]string{
+		"example.com/foo": "vendor/example.com/foo",
+		"igo/qux":         "qux",
+	}
+
+	if !reflect.DeepEqual(expectedImports, info.ResolvedImports) {
+		t.Errorf("Expected: %v\nGot: %v", expectedImports, info.ResolvedImports)
+	}
+}
+
+func TestSourceRootDir(t *testing.T) {
+	cases := [][2]string{
+		[2]string{"third_party", "third_party"},
+		[2]string{"./third_party/", "third_party"},
+		[2]string{"/a/b/third_party", "third_party"},
+		[2]string{"/a/b/c/../lib", "lib"},
+	}
+
+	for _, c := range cases {
+		dir, err := SourceRootDir("/a/b", c[0])
+		if err != nil || dir != c[1] {
+			t.Errorf("SourceRootDir(%s): expected %s, got (%s, %v)", c[0], c[1], dir, err)
+		}
+	}
+
+	for _, sourceRoot := range []string{"/a/c", "/a", "../lib", "/a/bc"} {
+		if _, err := SourceRootDir("/a/b", sourceRoot); err == nil {
+			t.Errorf("Expected an error for %s.", sourceRoot)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"igo/set"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// FindPackageDirs returns the directories at or beneath dir that contain .go
+// files, in sorted order. This is the expansion of the pattern "dir/...". Up to
+// jobs directories are read at once.
+//
+// Directories whose names begin with "." or "_", testdata and vendor
+// directories, and igo's output directory are not traversed.
+func FindPackageDirs(dir string, jobs int) []string {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	// A slot must be taken before reading a directory, and returned afterward.
+	slots := make(chan bool, jobs)
+	for i := 0; i < jobs; i++ {
+		slots <- true
+	}
+
+	listings := make(chan dirListing)
+	outstanding := 0
+
+	read := func(dir string) {
+		outstanding++
+		go func() {
+			<-slots
+			entries, _ := ioutil.ReadDir(dir)
+			slots <- true
+
+			listings <- dirListing{dir, entries}
+		}()
+	}
+
+	read(dir)
+
+	var dirs set.StringSet
+	for outstanding > 0 {
+		listing := <-listings
+		outstanding--
+
+		for _, entry := range listing.entries {
+			switch {
+			case entry.IsDirectory() && traversePackageDir(entry.Name):
+				read(path.Join(listing.dir, entry.Name))
+			case !entry.IsDirectory() && path.Ext(entry.Name) == ".go":
+				dirs.Insert(path.Clean(listing.dir))
+			}
+		}
+	}
+
+	return dirs.Sorted()
+}
+
+// The entries of a directory read by FindPackageDirs.
+type dirListing struct {
+	dir     string
+	entries []*os.Dir
+}
+
+// traversePackageDir returns true if FindPackageDirs should look for packages
+// within a sub-directory with the supplied name.
+func traversePackageDir(name string) bool {
+	return !strings.HasPrefix(name, ".") &&
+		!strings.HasPrefix(name, "_") &&
+		name != "testdata" &&
+		name != VendorDir &&
+		name != "igo-out"
+}
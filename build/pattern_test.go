@@ -0,0 +1,67 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFindPackageDirsEmptyDir(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	result := FindPackageDirs(dir, 1)
+	if len(result) != 0 {
+		t.Errorf("Expected no dirs, got: %v", result)
+	}
+}
+
+func TestFindPackageDirs(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createFile(dir, "root.go").Close()
+	createFile(createDir(dir, "foo"), "foo.go").Close()
+	createFile(createDir(dir, "bar"), "bar.go").Close()
+	createFile(createDir(dir, "bar/baz"), "qwerty_test.go").Close()
+	createFile(createDir(dir, "docs"), "README").Close()
+	createDir(dir, "empty/nested")
+
+	expected := []string{
+		dir,
+		path.Join(dir, "bar"),
+		path.Join(dir, "bar/baz"),
+		path.Join(dir, "foo"),
+	}
+
+	for _, jobs := range []int{1, 4} {
+		result := FindPackageDirs(dir, jobs)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected: %v\nGot: %v", expected, result)
+		}
+	}
+}
+
+func TestFindPackageDirsSkipsSpecialDirs(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createFile(createDir(dir, "foo"), "foo.go").Close()
+	createFile(createDir(dir, ".git"), "hooks.go").Close()
+	createFile(createDir(dir, "_obj"), "blah.go").Close()
+	createFile(createDir(dir, "igo-out"), "test_runner.go").Close()
+	createFile(createDir(dir, "vendor/example.com/foo"), "foo.go").Close()
+	createFile(createDir(dir, "foo/testdata"), "input.go").Close()
+	createFile(createDir(dir, "foo/testdata/nested"), "input.go").Close()
+
+	expected := []string{path.Join(dir, "foo")}
+
+	result := FindPackageDirs(dir, 4)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, result)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"container/vector"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// RootMarkerFile is the name of a file whose presence in a directory marks
+// that directory as the root of an igo project. Its contents are ignored.
+const RootMarkerFile = ".igoroot"
+
+// FindProjectRoot returns the root of the project containing dir, which must
+// be an absolute path. Local imports ("./foo") are resolved relative to the
+// project root.
+//
+// The nearest ancestor of dir (including dir itself) containing RootMarkerFile
+// or ModuleFile is used if there is one. Otherwise the root is the top-most
+// directory with local imports: starting from the nearest ancestor against
+// which all of the local imports of the package in dir resolve to directories
+// (or dir itself if it has none), igo walks up for as long as the parent
+// directory, or a directory immediately within it, holds a package whose local
+// imports resolve against the parent.
+func FindProjectRoot(dir string) string {
+	dir = path.Clean(dir)
+
+	for candidate := dir; ; candidate = parentDir(candidate) {
+		if isFile(path.Join(candidate, RootMarkerFile)) ||
+			isFile(path.Join(candidate, ModuleFile)) {
+			return candidate
+		}
+
+		if candidate == "/" {
+			break
+		}
+	}
+
+	root := dir
+	if deps := localDeps(dir); len(deps) > 0 {
+		for candidate := dir; ; candidate = parentDir(candidate) {
+			if allDirsExist(candidate, deps) {
+				root = candidate
+				break
+			}
+
+			if candidate == "/" {
+				break
+			}
+		}
+	}
+
+	// A leaf package has no local imports of its own, but other packages in the
+	// project import it.
+	for root != "/" && hasLocalImports(parentDir(root)) {
+		root = parentDir(root)
+	}
+
+	return root
+}
+
+// localDeps returns the local imports of the package in dir, including those
+// of its tests, relative to the root against which they are resolved.
+func localDeps(dir string) []string {
+	var result vector.StringVector
+	info := GetDirectoryInfo(dir)
+	info.Deps.Union(info.TestDeps)
+	for _, dep := range info.Deps.Sorted() {
+		// Vendored packages found by absolute path don't depend on the root.
+		if !strings.HasPrefix(dep, "/") {
+			result.Push(dep)
+		}
+	}
+
+	return result.Data()
+}
+
+// hasLocalImports returns true if the package in dir, or in one of its
+// immediate sub-directories, has local imports that all resolve to directories
+// when resolved against dir.
+func hasLocalImports(dir string) bool {
+	if deps := localDeps(dir); len(deps) > 0 && allDirsExist(dir, deps) {
+		return true
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDirectory() || strings.HasPrefix(entry.Name, ".") {
+			continue
+		}
+
+		subdir := path.Join(dir, entry.Name)
+		if deps := localDeps(subdir); len(deps) > 0 && allDirsExist(dir, deps) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RelativePath returns a relative path that refers to target when interpreted
+// relative to base. Both must be absolute paths.
+func RelativePath(base string, target string) string {
+	base = path.Clean(base)
+	target = path.Clean(target)
+
+	prefix := base
+	ups := ""
+	for prefix != "/" && target != prefix && !strings.HasPrefix(target, prefix+"/") {
+		prefix = parentDir(prefix)
+		ups += "../"
+	}
+
+	rest := ""
+	switch {
+	case target == prefix:
+		rest = ""
+	case prefix == "/":
+		rest = target[1:]
+	default:
+		rest = target[len(prefix)+1:]
+	}
+
+	return path.Clean(ups + rest)
+}
+
+// parentDir returns the parent of the supplied clean absolute path, or the
+// path itself if it is the root directory.
+func parentDir(dir string) string {
+	parent, _ := path.Split(dir)
+	if parent == "" {
+		return dir
+	}
+
+	return path.Clean(parent)
+}
+
+func isFile(name string) bool {
+	d, err := os.Stat(name)
+	return err == nil && d.IsRegular()
+}
+
+func allDirsExist(root string, dirs []string) bool {
+	for _, dir := range dirs {
+		d, err := os.Stat(path.Join(root, dir))
+		if err != nil || !d.IsDirectory() {
+			return false
+		}
+	}
+
+	return true
+}
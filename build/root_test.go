@@ -0,0 +1,165 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+func createDir(dir string, name string) string {
+	result := path.Join(dir, name)
+	err := os.MkdirAll(result, 0700)
+	if err != nil {
+		panic(fmt.Sprintf("Can't create dir [%s]: %s", result, err))
+	}
+
+	return result
+}
+
+func TestFindProjectRootMarkerFile(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createFile(dir, RootMarkerFile).Close()
+	subdir := createDir(dir, "bar/baz")
+
+	expectEqual(t, dir, FindProjectRoot(subdir))
+	expectEqual(t, dir, FindProjectRoot(dir))
+}
+
+func TestFindProjectRootModuleFile(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createFile(dir, ModuleFile).Close()
+	subdir := createDir(dir, "bar/baz")
+
+	expectEqual(t, dir, FindProjectRoot(subdir))
+}
+
+func TestFindProjectRootNearestMarkerFileWins(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createFile(dir, RootMarkerFile).Close()
+	nested := createDir(dir, "nested")
+	createFile(nested, RootMarkerFile).Close()
+	subdir := createDir(nested, "foo")
+
+	expectEqual(t, nested, FindProjectRoot(subdir))
+}
+
+func TestFindProjectRootFromLocalImports(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	createDir(dir, "foo")
+	subdir := createDir(dir, "bar/baz")
+
+	file := createFile(subdir, "qwerty.go")
+	defer file.Close()
+	writeFile(file, `
+		package baz
+		import "./foo"
+	`)
+
+	expectEqual(t, dir, FindProjectRoot(subdir))
+}
+
+func TestFindProjectRootNoLocalImports(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	subdir := createDir(dir, "foo")
+
+	file := createFile(subdir, "foo.go")
+	defer file.Close()
+	writeFile(file, `
+		package foo
+		import "fmt"
+	`)
+
+	expectEqual(t, subdir, FindProjectRoot(subdir))
+}
+
+func TestFindProjectRootLeafPackage(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	leaf := createDir(dir, "foo")
+	leafFile := createFile(leaf, "foo.go")
+	defer leafFile.Close()
+	writeFile(leafFile, `
+		package foo
+		import "fmt"
+	`)
+
+	driver := createDir(dir, "driver")
+	driverFile := createFile(driver, "driver.go")
+	defer driverFile.Close()
+	writeFile(driverFile, `
+		package main
+		import "./foo"
+	`)
+
+	expectEqual(t, dir, FindProjectRoot(leaf))
+	expectEqual(t, dir, FindProjectRoot(driver))
+}
+
+func TestFindProjectRootWalksUpToTopMostLocalImports(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	// bar/baz imports foo, which is only found against dir. The top-level
+	// package imports bar/baz, which is also only found against dir.
+	createDir(dir, "foo")
+	subdir := createDir(dir, "bar/baz")
+
+	file := createFile(subdir, "qwerty.go")
+	defer file.Close()
+	writeFile(file, `
+		package baz
+		import "./foo"
+	`)
+
+	topFile := createFile(dir, "top.go")
+	defer topFile.Close()
+	writeFile(topFile, `
+		package top
+		import "./bar/baz"
+	`)
+
+	expectEqual(t, dir, FindProjectRoot(subdir))
+	expectEqual(t, dir, FindProjectRoot(path.Join(dir, "foo")))
+}
+
+type relativePathCase struct {
+	base     string
+	target   string
+	expected string
+}
+
+func TestRelativePath(t *testing.T) {
+	cases := []relativePathCase{
+		relativePathCase{"/a/b", "/a/b", "."},
+		relativePathCase{"/a/b", "/a/b/c/d", "c/d"},
+		relativePathCase{"/a/b/c", "/a/b", ".."},
+		relativePathCase{"/a/b/c", "/a/d/e", "../../d/e"},
+		relativePathCase{"/a/bc", "/a/b", "../b"},
+		relativePathCase{"/a", "/", ".."},
+		relativePathCase{"/", "/a/b", "a/b"},
+		relativePathCase{"/a/b/", "/a/b/c/", "c"},
+	}
+
+	for _, c := range cases {
+		actual := RelativePath(c.base, c.target)
+		if actual != c.expected {
+			t.Errorf("RelativePath(%s, %s): expected %s, got %s",
+				c.base, c.target, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+// The cache package implements a persistent, content-addressed store for build
+// outputs. Entries are keyed by a hash of everything that went into producing
+// them, so a single cache directory can safely be shared by every branch and
+// checkout on a machine.
+package cache
+
+import (
+	"container/vector"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Hasher accumulates the inputs that determine a build output and produces
+// a cache key from them.
+type Hasher struct {
+	hash hash.Hash
+}
+
+// NewHasher returns a hasher with no inputs added.
+func NewHasher() *Hasher { return &Hasher{sha1.New()} }
+
+// AddString adds s to the inputs. Strings are length-prefixed, so adding "ab"
+// then "c" gives a different key from adding "a" then "bc".
+func (h *Hasher) AddString(s string) {
+	fmt.Fprintf(h.hash, "%d:%s", len(s), s)
+}
+
+// AddFile adds the name and contents of the supplied file to the inputs.
+func (h *Hasher) AddFile(name string) os.Error {
+	contents, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	h.AddString(name)
+	h.AddString(string(contents))
+	return nil
+}
+
+// Key returns the cache key for the inputs added so far.
+func (h *Hasher) Key() string { return fmt.Sprintf("%x", h.hash.Sum()) }
+
+// HashFile returns the key for a hasher to which only the contents of the
+// supplied file have been added.
+func HashFile(name string) (string, os.Error) {
+	contents, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	h := NewHasher()
+	h.AddString(string(contents))
+	return h.Key(), nil
+}
+
+// RunnerResultKey returns the key for a passing run of the supplied linked test
+// runner from the supplied directory, with the supplied arguments and
+// environment. The runner is keyed on its contents, which include the code of
+// the package under test and of everything that it links against, so a change
+// to the body of any function in them gives a different key. The files beneath
+// the directory's testdata/ subdirectory are included too, since tests commonly
+// read them. PWD and OLDPWD are ignored.
+func RunnerResultKey(runner string, dir string, args []string, env []string) (string, os.Error) {
+	runnerHash, err := HashFile(runner)
+	if err != nil {
+		return "", err
+	}
+
+	h := NewHasher()
+	h.AddString("test result")
+	h.AddString(runnerHash)
+	h.AddString(dir)
+
+	h.AddString("testdata")
+	var visitor fileVisitor
+	path.Walk(path.Join(dir, "testdata"), &visitor, nil)
+	testdata := visitor.files.Data()
+	sort.SortStrings(testdata)
+	for _, file := range testdata {
+		if err := h.AddFile(file); err != nil {
+			return "", err
+		}
+	}
+
+	h.AddString("args")
+	for _, arg := range args {
+		h.AddString(arg)
+	}
+
+	// The working directory is irrelevant to the test runner, but shows up in
+	// the environment.
+	h.AddString("env")
+	sortedEnv := make([]string, len(env))
+	copy(sortedEnv, env)
+	sort.SortStrings(sortedEnv)
+	for _, val := range sortedEnv {
+		if !strings.HasPrefix(val, "PWD=") && !strings.HasPrefix(val, "OLDPWD=") {
+			h.AddString(val)
+		}
+	}
+
+	return h.Key(), nil
+}
+
+// fileVisitor collects the names of the files visited by path.Walk.
+type fileVisitor struct {
+	files vector.StringVector
+}
+
+func (v *fileVisitor) VisitDir(dir string, d *os.Dir) bool { return true }
+func (v *fileVisitor) VisitFile(file string, d *os.Dir)    { v.files.Push(file) }
+
+// A Cache is a directory of entries, each of which holds a set of named files.
+// Hits and Misses count the results of calls to Get.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	Hits   int
+	Misses int
+}
+
+// usedFile is the name of a file within each entry whose modification time
+// records when the entry was last stored or retrieved.
+const usedFile = ".used"
+
+// New returns a cache stored in the supplied directory, which will be created
+// if necessary. Trim will evict entries until the cache holds no more than
+// maxBytes.
+func New(dir string, maxBytes int64) *Cache {
+	return &Cache{dir: dir, maxBytes: maxBytes}
+}
+
+func (c *Cache) entryDir(key string) string {
+	return path.Join(c.dir, key[0:2]+"/"+key)
+}
+
+// Get looks up the entry for key and, if it exists, copies its files to the
+// supplied destinations. files maps names within the entry to destination
+// paths. It returns true if and only if every file was restored.
+func (c *Cache) Get(key string, files map[string]string) bool {
+	entry := c.entryDir(key)
+
+	for name, dst := range files {
+		if err := CopyFile(path.Join(entry, name), dst); err != nil {
+			c.Misses++
+			return false
+		}
+	}
+
+	markUsed(entry)
+	c.Hits++
+	return true
+}
+
+// Put stores copies of the supplied files in the entry for key, replacing any
+// existing entry. files maps names within the entry to source paths. The entry
+// is assembled in a temporary directory and renamed into place, so concurrent
+// readers never see a partial entry.
+func (c *Cache) Put(key string, files map[string]string) os.Error {
+	entry := c.entryDir(key)
+	parent, _ := path.Split(entry)
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return err
+	}
+
+	tempDir := fmt.Sprintf("%s.tmp.%d", entry, os.Getpid())
+	os.RemoveAll(tempDir)
+	if err := os.Mkdir(tempDir, 0700); err != nil {
+		return err
+	}
+
+	for name, src := range files {
+		if err := CopyFile(src, path.Join(tempDir, name)); err != nil {
+			os.RemoveAll(tempDir)
+			return err
+		}
+	}
+
+	markUsed(tempDir)
+
+	os.RemoveAll(entry)
+	if err := os.Rename(tempDir, entry); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+
+	return nil
+}
+
+// Trim evicts the least recently used entries until the total size of the
+// cache is no more than its limit.
+func (c *Cache) Trim() os.Error {
+	// Nothing has been stored yet if the directory doesn't exist.
+	if _, err := os.Stat(c.dir); err != nil {
+		return nil
+	}
+
+	buckets, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	var entries entryList
+	var totalBytes int64
+	for _, bucket := range buckets {
+		if !bucket.IsDirectory() {
+			continue
+		}
+
+		bucketDir := path.Join(c.dir, bucket.Name)
+		names, err := ioutil.ReadDir(bucketDir)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range names {
+			if !d.IsDirectory() {
+				continue
+			}
+
+			e := getEntryInfo(path.Join(bucketDir, d.Name))
+			entries.Push(e)
+			totalBytes += e.size
+		}
+	}
+
+	sort.Sort(&entries)
+	for i := 0; i < entries.Len() && totalBytes > c.maxBytes; i++ {
+		e := entries.At(i).(*entryInfo)
+		if err := os.RemoveAll(e.dir); err != nil {
+			return err
+		}
+
+		totalBytes -= e.size
+	}
+
+	return nil
+}
+
+type entryInfo struct {
+	dir     string
+	size    int64
+	lastUse uint64
+}
+
+func getEntryInfo(dir string) *entryInfo {
+	result := &entryInfo{dir: dir}
+
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files {
+		result.size += int64(f.Size)
+		if f.Name == usedFile {
+			result.lastUse = f.Mtime_ns
+		}
+	}
+
+	return result
+}
+
+// entryList is a list of *entryInfo sortable by last use, oldest first.
+type entryList struct {
+	vector.Vector
+}
+
+func (l *entryList) Less(i, j int) bool {
+	return l.At(i).(*entryInfo).lastUse < l.At(j).(*entryInfo).lastUse
+}
+
+// markUsed records the current time as the last use of the supplied entry.
+func markUsed(entry string) {
+	ioutil.WriteFile(
+		path.Join(entry, usedFile),
+		strings.Bytes(fmt.Sprintf("%d", time.Nanoseconds())),
+		0600)
+}
+
+// CopyFile replaces dst with a copy of src, preserving src's permission bits
+// and creating dst's directory if necessary. The contents are first written to
+// a temporary file in the destination directory, which is then renamed into
+// place, so that readers of dst never see a partially written file.
+func CopyFile(src string, dst string) os.Error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	dir, file := path.Split(dst)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	tempFile := path.Join(dir, fmt.Sprintf(".%s.igo-tmp.%d", file, os.Getpid()))
+	err = ioutil.WriteFile(tempFile, contents, info.Permission())
+	if err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+
+	// The permissions given to WriteFile are subject to the umask, so set them
+	// explicitly.
+	if err := os.Chmod(tempFile, info.Permission()); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+
+	if err := os.Rename(tempFile, dst); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,352 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"once"
+	"os"
+	"path"
+	"rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedRand() { rand.Seed(time.Nanoseconds()) }
+
+func createTempDir() string {
+	once.Do(seedRand)
+	result := fmt.Sprintf("/tmp/cache_test.%d", rand.Uint32())
+	err := os.Mkdir(result, 0700)
+	if err != nil {
+		panic(fmt.Sprintf("Can't create dir [%s]: %s", result, err))
+	}
+
+	return result
+}
+
+func writeFile(name string, contents string) {
+	err := ioutil.WriteFile(name, strings.Bytes(contents), 0640)
+	if err != nil {
+		panic(fmt.Sprintf("Can't write file [%s]: %s", name, err))
+	}
+}
+
+func readFile(name string) string {
+	contents, err := ioutil.ReadFile(name)
+	if err != nil {
+		panic(fmt.Sprintf("Can't read file [%s]: %s", name, err))
+	}
+
+	return string(contents)
+}
+
+func keyFor(inputs []string) string {
+	h := NewHasher()
+	for _, val := range inputs {
+		h.AddString(val)
+	}
+
+	return h.Key()
+}
+
+////////////////////////////////
+// Hasher
+////////////////////////////////
+
+func TestHasherSameInputs(t *testing.T) {
+	key1 := keyFor([]string{"foo", "bar"})
+	key2 := keyFor([]string{"foo", "bar"})
+	if key1 != key2 {
+		t.Errorf("Expected equal keys, got %s and %s", key1, key2)
+	}
+}
+
+func TestHasherDifferentInputs(t *testing.T) {
+	key1 := keyFor([]string{"foo", "bar"})
+	key2 := keyFor([]string{"foo", "baz"})
+	if key1 == key2 {
+		t.Errorf("Expected different keys, got %s twice", key1)
+	}
+}
+
+func TestHasherInputBoundaries(t *testing.T) {
+	key1 := keyFor([]string{"ab", "c"})
+	key2 := keyFor([]string{"a", "bc"})
+	if key1 == key2 {
+		t.Errorf("Expected different keys, got %s twice", key1)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	writeFile(path.Join(dir, "a"), "taco")
+	writeFile(path.Join(dir, "b"), "taco")
+	writeFile(path.Join(dir, "c"), "burrito")
+
+	keyA, _ := HashFile(path.Join(dir, "a"))
+	keyB, _ := HashFile(path.Join(dir, "b"))
+	keyC, _ := HashFile(path.Join(dir, "c"))
+
+	if keyA != keyB {
+		t.Errorf("Expected equal keys, got %s and %s", keyA, keyB)
+	}
+
+	if keyA == keyC {
+		t.Errorf("Expected different keys, got %s twice", keyA)
+	}
+
+	if _, err := HashFile(path.Join(dir, "d")); err == nil {
+		t.Errorf("Expected an error for a missing file.")
+	}
+}
+
+////////////////////////////////
+// RunnerResultKey
+////////////////////////////////
+
+func TestRunnerResultKeyChangesWithDependencyBody(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	// The runner's archive is just the generated main, which is the same no
+	// matter what the package under test does. Only the linked runner
+	// includes the bodies of the functions that it calls.
+	runner := path.Join(dir, "foo_test_runner")
+	env := []string{"HOME=/home/user"}
+	writeFile(runner, "main; foo.Bar returns 1")
+	key1, err := RunnerResultKey(runner, dir, []string{}, env)
+	if err != nil {
+		t.Fatalf("RunnerResultKey: %s", err)
+	}
+
+	writeFile(path.Join(dir, "output"), "PASS")
+	c := New(path.Join(dir, "cache"), 1<<20)
+	c.Put(key1, map[string]string{"output": path.Join(dir, "output")})
+
+	writeFile(runner, "main; foo.Bar returns 2")
+	key2, err := RunnerResultKey(runner, dir, []string{}, env)
+	if err != nil {
+		t.Fatalf("RunnerResultKey: %s", err)
+	}
+
+	if c.Get(key2, map[string]string{"output": path.Join(dir, "restored")}) {
+		t.Errorf("Expected a miss after the dependency changed.")
+	}
+
+	writeFile(runner, "main; foo.Bar returns 1")
+	key3, _ := RunnerResultKey(runner, dir, []string{}, env)
+	if key3 != key1 {
+		t.Errorf("Expected %s, got %s", key1, key3)
+	}
+}
+
+func TestRunnerResultKeyTestdata(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	runner := path.Join(dir, "runner")
+	writeFile(runner, "runner")
+	os.Mkdir(path.Join(dir, "testdata"), 0700)
+	writeFile(path.Join(dir, "testdata/input"), "taco")
+	key1, _ := RunnerResultKey(runner, dir, []string{}, []string{})
+
+	writeFile(path.Join(dir, "testdata/input"), "burrito")
+	key2, _ := RunnerResultKey(runner, dir, []string{}, []string{})
+
+	if key1 == key2 {
+		t.Errorf("Expected different keys, got %s twice", key1)
+	}
+}
+
+func TestRunnerResultKeyIgnoresWorkingDirectory(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	runner := path.Join(dir, "runner")
+	writeFile(runner, "runner")
+
+	key1, _ := RunnerResultKey(runner, dir, []string{}, []string{"A=b", "PWD=/foo"})
+	key2, _ := RunnerResultKey(runner, dir, []string{}, []string{"OLDPWD=/baz", "PWD=/bar", "A=b"})
+	if key1 != key2 {
+		t.Errorf("Expected equal keys, got %s and %s", key1, key2)
+	}
+
+	key3, _ := RunnerResultKey(runner, dir, []string{}, []string{"A=c", "PWD=/foo"})
+	if key1 == key3 {
+		t.Errorf("Expected different keys, got %s twice", key1)
+	}
+}
+
+func TestRunnerResultKeyMissingRunner(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	if _, err := RunnerResultKey(path.Join(dir, "runner"), dir, []string{}, []string{}); err == nil {
+		t.Errorf("Expected an error for a missing runner.")
+	}
+}
+
+////////////////////////////////
+// Cache
+////////////////////////////////
+
+func TestGetMissingEntry(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	c := New(path.Join(dir, "cache"), 1<<20)
+	files := map[string]string{"foo.a": path.Join(dir, "foo.a")}
+	if c.Get(keyFor([]string{"foo"}), files) {
+		t.Errorf("Expected a miss.")
+	}
+
+	if c.Hits != 0 || c.Misses != 1 {
+		t.Errorf("Expected 0 hits and 1 miss, got %d and %d", c.Hits, c.Misses)
+	}
+}
+
+func TestPutThenGet(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	writeFile(path.Join(dir, "foo.6"), "object")
+	writeFile(path.Join(dir, "foo.a"), "archive")
+
+	c := New(path.Join(dir, "cache"), 1<<20)
+	key := keyFor([]string{"foo"})
+	err := c.Put(key, map[string]string{
+		"foo.6": path.Join(dir, "foo.6"),
+		"foo.a": path.Join(dir, "foo.a"),
+	})
+
+	if err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+
+	outDir := path.Join(dir, "out")
+	os.Mkdir(outDir, 0700)
+	ok := c.Get(key, map[string]string{
+		"foo.6": path.Join(outDir, "foo.6"),
+		"foo.a": path.Join(outDir, "foo.a"),
+	})
+
+	if !ok {
+		t.Fatalf("Expected a hit.")
+	}
+
+	if c.Hits != 1 || c.Misses != 0 {
+		t.Errorf("Expected 1 hit and 0 misses, got %d and %d", c.Hits, c.Misses)
+	}
+
+	if contents := readFile(path.Join(outDir, "foo.6")); contents != "object" {
+		t.Errorf("Expected object, got %s", contents)
+	}
+
+	if contents := readFile(path.Join(outDir, "foo.a")); contents != "archive" {
+		t.Errorf("Expected archive, got %s", contents)
+	}
+
+	d, _ := os.Stat(path.Join(outDir, "foo.a"))
+	if d.Permission() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", d.Permission())
+	}
+}
+
+func TestPutReplacesEntry(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	c := New(path.Join(dir, "cache"), 1<<20)
+	key := keyFor([]string{"foo"})
+	src := path.Join(dir, "src")
+	dst := path.Join(dir, "dst")
+
+	writeFile(src, "old")
+	c.Put(key, map[string]string{"f": src})
+	writeFile(src, "new")
+	c.Put(key, map[string]string{"f": src})
+
+	if !c.Get(key, map[string]string{"f": dst}) {
+		t.Fatalf("Expected a hit.")
+	}
+
+	if contents := readFile(dst); contents != "new" {
+		t.Errorf("Expected new, got %s", contents)
+	}
+}
+
+func TestTrimEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	src := path.Join(dir, "src")
+	writeFile(src, strings.Repeat("x", 1000))
+
+	c := New(path.Join(dir, "cache"), 1500)
+	key1 := keyFor([]string{"1"})
+	key2 := keyFor([]string{"2"})
+
+	c.Put(key1, map[string]string{"f": src})
+	time.Sleep(10e6)
+	c.Put(key2, map[string]string{"f": src})
+	time.Sleep(10e6)
+
+	// Using the first entry makes the second one the least recently used.
+	c.Get(key1, map[string]string{"f": path.Join(dir, "dst")})
+
+	if err := c.Trim(); err != nil {
+		t.Fatalf("Trim: %s", err)
+	}
+
+	dst := path.Join(dir, "dst")
+	if !c.Get(key1, map[string]string{"f": dst}) {
+		t.Errorf("Expected the recently used entry to survive.")
+	}
+
+	if c.Get(key2, map[string]string{"f": dst}) {
+		t.Errorf("Expected the least recently used entry to be evicted.")
+	}
+}
+
+////////////////////////////////
+// CopyFile
+////////////////////////////////
+
+func TestCopyFileCreatesDirectoryAndReplacesFile(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	src := path.Join(dir, "foo.a")
+	writeFile(src, "archive")
+	os.Chmod(src, 0750)
+
+	dst := path.Join(dir, "pkg/bar/foo.a")
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile: %s", err)
+	}
+
+	writeFile(src, "new archive")
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile: %s", err)
+	}
+
+	if contents := readFile(dst); contents != "new archive" {
+		t.Errorf("Expected new archive, got %s", contents)
+	}
+
+	d, _ := os.Stat(dst)
+	if d.Permission() != 0750 {
+		t.Errorf("Expected mode 0750, got %o", d.Permission())
+	}
+
+	entries, _ := ioutil.ReadDir(path.Join(dir, "pkg/bar"))
+	if len(entries) != 1 {
+		t.Errorf("Expected only foo.a, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+// The cover package implements statement coverage for tests. Source files are
+// instrumented so that each block of statements sets a counter when it runs,
+// and the counters are later matched back up with the blocks to produce
+// reports.
+package cover
+
+import (
+	"container/vector"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// CounterPackage is the import path, relative to igo's output directory, of
+// the package holding the counters. Instrumented files import it under the
+// name CounterPackageName.
+const CounterPackage = "./_igocover"
+const CounterPackageName = "igo_cover"
+
+// A Block is a sequence of statements in a source file that are instrumented
+// with a single counter.
+type Block struct {
+	File      string
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmts  int
+}
+
+// Instrument parses the supplied source code for a .go file and returns a copy
+// in which every block of statements sets a counter when it runs. The
+// counters are numbered consecutively from firstIndex, in the order of the
+// returned blocks. file is the name recorded in the blocks.
+func Instrument(file string, source string, firstIndex int) (string, []Block, os.Error) {
+	fileNode, err := parser.ParseFile(file, source, nil, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	visitor := instrumentVisitor{
+		file:         file,
+		switchBodies: make(map[int]bool),
+		clauseEnds:   make(map[int]token.Position),
+	}
+
+	ast.Walk(&visitor, fileNode)
+
+	// Number the blocks in source order, and insert the code to set each one's
+	// counter.
+	sort.Sort(&visitor.points)
+	blocks := make([]Block, visitor.points.Len())
+	var insertions insertionList
+
+	for i := 0; i < visitor.points.Len(); i++ {
+		point := visitor.points.At(i).(*insertion)
+		blocks[i] = point.block
+		insertions.Push(&insertion{
+			offset: point.offset,
+			text:   fmt.Sprintf("%s.Counts[%d] = 1;", CounterPackageName, firstIndex+i),
+		})
+	}
+
+	// Import the counter package straight after the package clause, and make
+	// sure the import is used even if the file has no blocks.
+	nameOffset := fileNode.Name.Pos().Offset + len(fileNode.Name.Name())
+	insertions.Push(&insertion{
+		offset: nameOffset,
+		text: fmt.Sprintf(
+			"; import %s %s",
+			CounterPackageName,
+			strconv.Quote(CounterPackage)),
+	})
+
+	sort.Sort(&insertions)
+
+	result := ""
+	last := 0
+	for i := 0; i < insertions.Len(); i++ {
+		point := insertions.At(i).(*insertion)
+		result += source[last:point.offset] + point.text
+		last = point.offset
+	}
+
+	result += source[last:]
+	result += fmt.Sprintf("\nvar _ = %s.Counts\n", CounterPackageName)
+
+	return result, blocks, nil
+}
+
+// An insertion is a piece of code to be inserted into a source file at a
+// byte offset, along with the block it instruments (if any).
+type insertion struct {
+	offset int
+	text   string
+	block  Block
+}
+
+// insertionList is a list of *insertion sortable by offset.
+type insertionList struct {
+	vector.Vector
+}
+
+func (l *insertionList) Less(i, j int) bool {
+	return l.At(i).(*insertion).offset < l.At(j).(*insertion).offset
+}
+
+type instrumentVisitor struct {
+	file   string
+	points insertionList
+
+	// The offsets of the bodies of switch and select statements, which contain
+	// clauses rather than statements and so can't be instrumented themselves.
+	switchBodies map[int]bool
+
+	// The positions at which each clause of the switch and select statements
+	// seen so far ends, keyed by the offset of the clause.
+	clauseEnds map[int]token.Position
+}
+
+func (v *instrumentVisitor) Visit(node interface{}) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.SwitchStmt:
+		v.addSwitchBody(n.Body)
+	case *ast.TypeSwitchStmt:
+		v.addSwitchBody(n.Body)
+	case *ast.SelectStmt:
+		v.addSwitchBody(n.Body)
+
+	case *ast.BlockStmt:
+		if !v.switchBodies[n.Pos().Offset] {
+			v.addBlock(n.Pos(), n.Rbrace, len(n.List))
+		}
+
+	case *ast.CaseClause:
+		v.addBlock(n.Colon, v.clauseEnds[n.Pos().Offset], len(n.Body))
+	case *ast.TypeCaseClause:
+		v.addBlock(n.Colon, v.clauseEnds[n.Pos().Offset], len(n.Body))
+	case *ast.CommClause:
+		v.addBlock(n.Colon, v.clauseEnds[n.Pos().Offset], len(n.Body))
+	}
+
+	return v
+}
+
+// addSwitchBody records that body holds the clauses of a switch or select
+// statement. Each clause ends where the next begins, and the last where the
+// body ends.
+func (v *instrumentVisitor) addSwitchBody(body *ast.BlockStmt) {
+	v.switchBodies[body.Pos().Offset] = true
+
+	for i, clause := range body.List {
+		end := body.Rbrace
+		if i+1 < len(body.List) {
+			end = body.List[i+1].Pos()
+		}
+
+		v.clauseEnds[clause.Pos().Offset] = end
+	}
+}
+
+// addBlock records a block containing numStmts statements, whose counter is
+// to be set by code inserted just after the token at start.
+func (v *instrumentVisitor) addBlock(start token.Position, end token.Position, numStmts int) {
+	if numStmts == 0 {
+		return
+	}
+
+	v.points.Push(&insertion{
+		offset: start.Offset + 1,
+		block: Block{
+			File:      v.file,
+			StartLine: start.Line,
+			StartCol:  start.Column,
+			EndLine:   end.Line,
+			EndCol:    end.Column,
+			NumStmts:  numStmts,
+		},
+	})
+}
+
+// GenerateCounterPackage returns the source code for the package, imported by
+// instrumented files as CounterPackage, that holds the supplied number of
+// counters.
+func GenerateCounterPackage(numCounters int) string {
+	return fmt.Sprintf(counterPackageTemplate, CounterPackageName, numCounters)
+}
+
+const counterPackageTemplate = `package %s
+
+import "io/ioutil"
+
+var Counts [%d]uint8
+
+// WriteCounts writes a file containing one character per counter: '1' if it
+// has been set, and '0' otherwise.
+func WriteCounts(file string) {
+	data := make([]byte, len(Counts))
+	for i, count := range Counts {
+		data[i] = '0' + count
+	}
+
+	ioutil.WriteFile(file, data, 0600)
+}
+`
+
+// GenerateRunnerHook returns the source code for a file that, when compiled
+// into a test runner generated by the test package, writes the counters to the
+// supplied file after each test. See ParseCounts.
+func GenerateRunnerHook(countsFile string) string {
+	return fmt.Sprintf(
+		runnerHookTemplate,
+		CounterPackageName,
+		strconv.Quote(CounterPackage),
+		CounterPackageName,
+		strconv.Quote(countsFile))
+}
+
+const runnerHookTemplate = `package main
+
+import %s %s
+
+func init() {
+	igotest_afterTest = func() { %s.WriteCounts(%s) }
+}
+`
@@ -0,0 +1,147 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package cover
+
+import (
+	"reflect"
+	"testing"
+)
+
+func expectSourceEqual(t *testing.T, expected string, actual string) {
+	if expected != actual {
+		t.Errorf("Expected:\n---------\n%s\n\nActual:\n---------\n%s", expected, actual)
+	}
+}
+
+func expectBlocksEqual(t *testing.T, expected []Block, actual []Block) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected: %v\nGot: %v", expected, actual)
+	}
+}
+
+func TestInstrumentSyntaxError(t *testing.T) {
+	_, _, err := Instrument("foo.go", "package foo\n\nfunc Abs(x int) {\n", 0)
+	if err == nil {
+		t.Errorf("Expected an error.")
+	}
+}
+
+func TestInstrumentNoBlocks(t *testing.T) {
+	code := `package foo
+
+func DoNothing() {}
+`
+	expected := `package foo; import igo_cover "./_igocover"
+
+func DoNothing() {}
+
+var _ = igo_cover.Counts
+`
+
+	result, blocks, err := Instrument("foo.go", code, 0)
+	if err != nil {
+		t.Fatalf("Instrument: %s", err)
+	}
+
+	expectSourceEqual(t, expected, result)
+	expectBlocksEqual(t, []Block{}, blocks)
+}
+
+func TestInstrumentNestedBlocks(t *testing.T) {
+	code := `package foo
+
+func Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+`
+	expected := `package foo; import igo_cover "./_igocover"
+
+func Abs(x int) int {igo_cover.Counts[5] = 1;
+	if x < 0 {igo_cover.Counts[6] = 1;
+		return -x
+	}
+
+	return x
+}
+
+var _ = igo_cover.Counts
+`
+
+	result, blocks, err := Instrument("foo/abs.go", code, 5)
+	if err != nil {
+		t.Fatalf("Instrument: %s", err)
+	}
+
+	expectSourceEqual(t, expected, result)
+	expectBlocksEqual(
+		t,
+		[]Block{
+			Block{"foo/abs.go", 3, 21, 9, 1, 2},
+			Block{"foo/abs.go", 4, 11, 6, 2, 1},
+		},
+		blocks)
+}
+
+func TestInstrumentSwitch(t *testing.T) {
+	code := `package foo
+
+func Sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+
+	return 0
+}
+`
+	expected := `package foo; import igo_cover "./_igocover"
+
+func Sign(x int) int {igo_cover.Counts[0] = 1;
+	switch {
+	case x < 0:igo_cover.Counts[1] = 1;
+		return -1
+	case x > 0:igo_cover.Counts[2] = 1;
+		return 1
+	}
+
+	return 0
+}
+
+var _ = igo_cover.Counts
+`
+
+	result, blocks, err := Instrument("sign.go", code, 0)
+	if err != nil {
+		t.Fatalf("Instrument: %s", err)
+	}
+
+	expectSourceEqual(t, expected, result)
+	expectBlocksEqual(
+		t,
+		[]Block{
+			Block{"sign.go", 3, 22, 12, 1, 2},
+			Block{"sign.go", 5, 12, 7, 2, 1},
+			Block{"sign.go", 7, 12, 9, 2, 1},
+		},
+		blocks)
+}
+
+func TestGenerateRunnerHook(t *testing.T) {
+	expected := `package main
+
+import igo_cover "./_igocover"
+
+func init() {
+	igotest_afterTest = func() { igo_cover.WriteCounts("/tmp/foo.cover") }
+}
+`
+
+	expectSourceEqual(t, expected, GenerateRunnerHook("/tmp/foo.cover"))
+}
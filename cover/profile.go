@@ -0,0 +1,203 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package cover
+
+import (
+	"bytes"
+	"container/vector"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseCounts parses the contents of a file written by a test runner hook
+// (see GenerateRunnerHook), returning whether each counter was set. Missing
+// counters are treated as unset.
+func ParseCounts(contents string, numCounters int) []bool {
+	result := make([]bool, numCounters)
+	for i := 0; i < numCounters && i < len(contents); i++ {
+		result[i] = contents[i] == '1'
+	}
+
+	return result
+}
+
+// Merge marks as covered in dst every block that is covered in src.
+func Merge(dst []bool, src []bool) {
+	for i := 0; i < len(dst) && i < len(src); i++ {
+		dst[i] = dst[i] || src[i]
+	}
+}
+
+// Summarize returns the number of statements in the supplied blocks that are
+// covered, and the total number of statements.
+func Summarize(blocks []Block, covered []bool) (coveredStmts int, totalStmts int) {
+	for i, block := range blocks {
+		totalStmts += block.NumStmts
+		if covered[i] {
+			coveredStmts += block.NumStmts
+		}
+	}
+
+	return
+}
+
+// Percentage returns the percentage of statements covered, treating an empty
+// set of statements as fully covered.
+func Percentage(coveredStmts int, totalStmts int) float64 {
+	if totalStmts == 0 {
+		return 100
+	}
+
+	return 100 * float64(coveredStmts) / float64(totalStmts)
+}
+
+// FormatProfile returns a coverage profile for the supplied blocks in the
+// format used by Go's cover tool, in "set" mode.
+func FormatProfile(blocks []Block, covered []bool) string {
+	var buf bytes.Buffer
+	buf.WriteString("mode: set\n")
+
+	for i, block := range blocks {
+		count := 0
+		if covered[i] {
+			count = 1
+		}
+
+		fmt.Fprintf(
+			&buf,
+			"%s:%d.%d,%d.%d %d %d\n",
+			block.File,
+			block.StartLine,
+			block.StartCol,
+			block.EndLine,
+			block.EndCol,
+			block.NumStmts,
+			count)
+	}
+
+	return buf.String()
+}
+
+// RenderHTML returns an HTML page showing the source of each file containing
+// the supplied blocks, with covered lines in green and uncovered lines in red.
+// sources maps file names to their contents.
+func RenderHTML(blocks []Block, covered []bool, sources map[string]string) string {
+	// Group the blocks by file.
+	var files vector.StringVector
+	byFile := make(map[string]*vector.IntVector)
+	for i, block := range blocks {
+		indices, ok := byFile[block.File]
+		if !ok {
+			indices = new(vector.IntVector)
+			byFile[block.File] = indices
+			files.Push(block.File)
+		}
+
+		indices.Push(i)
+	}
+
+	fileNames := files.Data()
+	sort.SortStrings(fileNames)
+
+	var buf bytes.Buffer
+	buf.WriteString(htmlHeader)
+
+	for _, file := range fileNames {
+		indices := byFile[file]
+
+		// Work out the status of each line. A line touched by an uncovered block
+		// is uncovered, even if a covered block touches it too.
+		lineStatus := make(map[int]string)
+		fileBlocks := make([]Block, indices.Len())
+		fileCovered := make([]bool, indices.Len())
+
+		for i := 0; i < indices.Len(); i++ {
+			index := indices.At(i)
+			fileBlocks[i] = blocks[index]
+			fileCovered[i] = covered[index]
+
+			block := blocks[index]
+			for line := block.StartLine; line <= block.EndLine; line++ {
+				if !covered[index] {
+					lineStatus[line] = "uncov"
+				} else if lineStatus[line] == "" {
+					lineStatus[line] = "cov"
+				}
+			}
+		}
+
+		coveredStmts, totalStmts := Summarize(fileBlocks, fileCovered)
+		fmt.Fprintf(
+			&buf,
+			"<h2>%s (%.1f%%)</h2>\n<pre>",
+			htmlEscape(file),
+			Percentage(coveredStmts, totalStmts))
+
+		lines := splitLines(sources[file])
+		for i, line := range lines {
+			status := lineStatus[i+1]
+			if status == "" {
+				buf.WriteString(htmlEscape(line))
+			} else {
+				fmt.Fprintf(&buf, "<span class=\"%s\">%s</span>", status, htmlEscape(line))
+			}
+
+			buf.WriteString("\n")
+		}
+
+		buf.WriteString("</pre>\n")
+	}
+
+	buf.WriteString("</body>\n</html>\n")
+	return buf.String()
+}
+
+const htmlHeader = `<html>
+<head>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; }
+.cov { color: #008000; }
+.uncov { color: #c00000; }
+</style>
+</head>
+<body>
+`
+
+func splitLines(s string) []string {
+	var result vector.StringVector
+	for s != "" {
+		end := strings.Index(s, "\n")
+		if end < 0 {
+			result.Push(s)
+			break
+		}
+
+		result.Push(s[0:end])
+		s = s[end+1:]
+	}
+
+	return result.Data()
+}
+
+func htmlEscape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '"':
+			buf.WriteString("&quot;")
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,96 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package cover
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testBlocks = []Block{
+	Block{"foo/abs.go", 3, 21, 9, 1, 2},
+	Block{"foo/abs.go", 4, 11, 6, 2, 1},
+	Block{"foo/sign.go", 3, 22, 12, 1, 3},
+}
+
+func TestParseCounts(t *testing.T) {
+	expected := []bool{true, false, true, false}
+	result := ParseCounts("101", 4)
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("Expected: %v\nGot: %v", expected, result)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dst := []bool{true, false, false}
+	Merge(dst, []bool{false, true, false})
+
+	expected := []bool{true, true, false}
+	if !reflect.DeepEqual(expected, dst) {
+		t.Errorf("Expected: %v\nGot: %v", expected, dst)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	coveredStmts, totalStmts := Summarize(testBlocks, []bool{true, false, true})
+	if coveredStmts != 5 || totalStmts != 6 {
+		t.Errorf("Expected 5 of 6, got %d of %d", coveredStmts, totalStmts)
+	}
+
+	if p := Percentage(3, 4); p != 75 {
+		t.Errorf("Expected 75, got %v", p)
+	}
+
+	if p := Percentage(0, 0); p != 100 {
+		t.Errorf("Expected 100, got %v", p)
+	}
+}
+
+func TestFormatProfile(t *testing.T) {
+	expected := `mode: set
+foo/abs.go:3.21,9.1 2 1
+foo/abs.go:4.11,6.2 1 0
+foo/sign.go:3.22,12.1 3 1
+`
+
+	expectSourceEqual(t, expected, FormatProfile(testBlocks, []bool{true, false, true}))
+}
+
+func TestRenderHTML(t *testing.T) {
+	sources := map[string]string{
+		"foo/abs.go": `package foo
+
+func Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+`,
+		"foo/sign.go": "",
+	}
+
+	result := RenderHTML(testBlocks[0:2], []bool{true, false}, sources)
+
+	expectedSnippets := []string{
+		"<h2>foo/abs.go (66.7%)</h2>",
+		"package foo\n",
+		"<span class=\"cov\">func Abs(x int) int {</span>\n",
+		"<span class=\"uncov\">\tif x &lt; 0 {</span>\n",
+		"<span class=\"uncov\">\t}</span>\n",
+		"<span class=\"cov\">\treturn x</span>\n",
+	}
+
+	for _, snippet := range expectedSnippets {
+		if strings.Index(result, snippet) < 0 {
+			t.Errorf("Expected output to contain [%s], got:\n%s", snippet, result)
+		}
+	}
+
+	if strings.Index(result, "sign.go") >= 0 {
+		t.Errorf("Expected no section for a file without blocks, got:\n%s", result)
+	}
+}
@@ -6,6 +6,7 @@
 package deps
 
 import (
+	"container/heap"
 	"container/vector"
 	"igo/set"
 )
@@ -14,45 +15,72 @@ import (
 // those packages, and returns a safe order in which to compile them (assuming
 // there are no circular dependencies). The result will contain only those
 // packages which were present as keys in deps.
+//
+// The order is deterministic: whenever more than one package could come next,
+// the first by name is chosen. Any circular dependencies are broken at the
+// first package by name that is part of or depends upon the cycle.
 func BuildTotalOrder(deps map[string]*set.StringSet) []string {
-	var visitor topologicalSortVisitor
-	visitor.nodes = make(map[string]*packageNode)
-	visitor.edges = deps
+	// Count the dependencies of each package that are yet to be ordered, and
+	// record the reverse edges.
+	var unordered set.StringSet
+	remaining := make(map[string]int)
+	dependents := make(map[string]*set.StringSet)
 
-	for key, _ := range deps {
-		visitor.nodes[key] = &packageNode{}
+	for name, _ := range deps {
+		unordered.Insert(name)
+		dependents[name] = &set.StringSet{}
 	}
 
-	for key, _ := range deps {
-		visitor.Visit(key)
+	for name, nameDeps := range deps {
+		for dep := range nameDeps.Iter() {
+			if _, ok := deps[dep]; ok && dep != name {
+				remaining[name]++
+				dependents[dep].Insert(name)
+			}
+		}
 	}
 
-	return visitor.result.Data()
-}
+	// Keep the packages whose dependencies have all been ordered in a heap, so
+	// that the first by name can be taken without sorting on each step.
+	ready := &nameHeap{}
+	for name, _ := range deps {
+		if remaining[name] == 0 {
+			ready.Push(name)
+		}
+	}
+	heap.Init(ready)
 
-type packageNode struct {
-	visited bool
-}
+	var result vector.StringVector
+	for unordered.Len() > 0 {
+		var next string
+		if ready.Len() > 0 {
+			next = heap.Pop(ready).(string)
+		} else {
+			// Everything left is part of or depends upon a cycle.
+			next = unordered.Sorted()[0]
+		}
 
-// Implements a depth-first search topological sort algorithm for directed
-// acyclic graphs.
-type topologicalSortVisitor struct {
-	result vector.StringVector
-	nodes  map[string]*packageNode
-	edges  map[string]*set.StringSet
-}
+		unordered.Remove(next)
+		result.Push(next)
 
-func (v *topologicalSortVisitor) Visit(name string) {
-	// Is this an unvisited node for a package we care about?
-	node, ok := v.nodes[name]
-	if !ok || node.visited {
-		return
+		for dependent := range dependents[next].Iter() {
+			remaining[dependent]--
+			if remaining[dependent] == 0 && unordered.Contains(dependent) {
+				heap.Push(ready, dependent)
+			}
+		}
 	}
 
-	node.visited = true
-	for otherName := range v.edges[name].Iter() {
-		v.Visit(otherName)
-	}
+	return result.Data()
+}
 
-	v.result.Push(name)
+// nameHeap is a min-heap of package names, for use with container/heap.
+type nameHeap struct {
+	vector.StringVector
 }
+
+func (h *nameHeap) Less(i, j int) bool { return h.At(i) < h.At(j) }
+
+func (h *nameHeap) Push(x interface{}) { h.StringVector.Push(x.(string)) }
+
+func (h *nameHeap) Pop() interface{} { return h.StringVector.Pop() }
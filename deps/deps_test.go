@@ -135,3 +135,46 @@ func TestCircularDependency(t *testing.T) {
 	expectContains(t, result, "foo")
 	expectContains(t, result, "bar")
 }
+
+func TestTiesBrokenByName(t *testing.T) {
+	input := make(map[string]*set.StringSet)
+	addDeps(input, "foo", []string{"baz"})
+	addDeps(input, "bar", []string{"foo"})
+	addDeps(input, "baz", []string{})
+	addDeps(input, "tony", []string{"baz", "fmt"})
+	addDeps(input, "alpha", []string{})
+
+	result := BuildTotalOrder(input)
+	expected := []string{"alpha", "baz", "foo", "bar", "tony"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\nGot:%v", expected, result)
+	}
+}
+
+func TestCircularDependencyIsDeterministic(t *testing.T) {
+	input := make(map[string]*set.StringSet)
+	addDeps(input, "foo", []string{"bar"})
+	addDeps(input, "bar", []string{"foo"})
+	addDeps(input, "baz", []string{"foo"})
+	addDeps(input, "qux", []string{})
+
+	result := BuildTotalOrder(input)
+	expected := []string{"qux", "bar", "foo", "baz"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\nGot:%v", expected, result)
+	}
+}
+
+func TestNewlyReadyPackageTakenByName(t *testing.T) {
+	input := make(map[string]*set.StringSet)
+	addDeps(input, "c", []string{})
+	addDeps(input, "d", []string{})
+	addDeps(input, "a", []string{"c"})
+	addDeps(input, "e", []string{"d"})
+
+	result := BuildTotalOrder(input)
+	expected := []string{"c", "a", "d", "e"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\nGot:%v", expected, result)
+	}
+}
@@ -1,9 +1,12 @@
 #!/bin/bash
 
 make -C set/ install && \
+  make -C cache/ install &&
+  make -C cover/ install &&
   make -C deps/ install &&
   make -C parse/ install &&
   make -C build/ install &&
   make -C test/ install &&
+  make -C trace/ install &&
   make -C main/ install &&
   rm main/igo
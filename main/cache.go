@@ -0,0 +1,215 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"igo/cache"
+	"igo/set"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+var cacheDir = flag.String(
+	"cachedir",
+	"",
+	"Directory holding the persistent build cache. Defaults to $HOME/.cache/igo.")
+
+var cacheSize = flag.Int(
+	"cachesize",
+	1024,
+	"Maximum size of the build cache, in megabytes.")
+
+var noCache = flag.Bool("nocache", false, "Don't use the persistent build cache.")
+
+var testCount = flag.Int(
+	"count",
+	0,
+	"Run each test runner this many times, ignoring cached test results. "+
+		"By default tests are run once unless a passing result is cached.")
+
+// The build cache, or nil if it is disabled.
+var buildCache *cache.Cache
+
+// Hashes of the contents of compiled archives, keyed by the target base name
+// passed to compileFiles.
+var archiveHashes = make(map[string]string)
+
+// A hash of the compiler and archiver binaries and the target, computed lazily
+// by getToolchainID.
+var toolchainID string
+
+// initBuildCache sets up buildCache according to the flags. The cache is
+// disabled when verifying reproducibility, so that both builds run the tools.
+func initBuildCache() {
+	if *noCache || *verifyReproducible {
+		return
+	}
+
+	dir := *cacheDir
+	if dir == "" {
+		if os.Getenv("HOME") == "" {
+			return
+		}
+
+		dir = path.Join(os.Getenv("HOME"), ".cache/igo")
+	} else if !strings.HasPrefix(dir, "/") {
+		dir = path.Join(userDir, dir)
+	}
+
+	buildCache = cache.New(dir, int64(*cacheSize)<<20)
+}
+
+// finishBuildCache reports cache statistics and evicts old entries.
+func finishBuildCache() {
+	if buildCache == nil {
+		return
+	}
+
+	fmt.Printf(
+		"\nBuild cache: %d hits, %d misses\n",
+		buildCache.Hits,
+		buildCache.Misses)
+
+	if err := buildCache.Trim(); err != nil {
+		fmt.Printf("Warning: couldn't trim the build cache: %s\n", err)
+	}
+}
+
+func getToolchainID() string {
+	if toolchainID != "" {
+		return toolchainID
+	}
+
+	compilerPath, gopackPath := getCompilerPaths()
+
+	h := cache.NewHasher()
+	h.AddString(os.Getenv("GOOS"))
+	h.AddString(os.Getenv("GOARCH"))
+	for _, tool := range []string{compilerPath, gopackPath} {
+		if err := h.AddFile(tool); err != nil {
+			panic(err)
+		}
+	}
+
+	toolchainID = h.Key()
+	return toolchainID
+}
+
+// compileKey returns the cache key for compiling the supplied .go files and
+// other files (see compileFiles), which depend upon the supplied local
+// packages, with the supplied compiler arguments. The arguments are the full
+// list passed to the compiler, including the output, the directories searched
+// for imports and the names of the files. The dependencies must already have
+// been compiled.
+func compileKey(
+	compilerArgs []string,
+	files *set.StringSet,
+	otherFiles *set.StringSet,
+	localDeps *set.StringSet) string {
+	h := cache.NewHasher()
+	h.AddString(getToolchainID())
+
+	h.AddString("args")
+	for _, arg := range compilerArgs {
+		h.AddString(arg)
+	}
+
+	h.AddString("files")
+	for _, file := range files.Sorted() {
+		if err := h.AddFile(file); err != nil {
+			panic(err)
+		}
+	}
+
+	// The tools that build the other files only matter if there are any.
+	h.AddString("other files")
+	for _, file := range otherFiles.Sorted() {
+		h.AddString(path.Ext(file))
+		if path.Ext(file) != ".o" {
+			toolPath, toolArgs := objectTool(file)
+			if err := h.AddFile(toolPath); err != nil {
+				panic(err)
+			}
+
+			for _, arg := range toolArgs {
+				h.AddString(arg)
+			}
+		}
+
+		if err := h.AddFile(file); err != nil {
+			panic(err)
+		}
+	}
+
+	h.AddString("deps")
+	for _, dep := range localDeps.Sorted() {
+		h.AddString(dep)
+		h.AddString(archiveHashes[dep])
+	}
+
+	return h.Key()
+}
+
+// recordArchiveHash stores the hash of the archive for the supplied target,
+// for use in the keys of packages that depend upon it.
+func recordArchiveHash(targetBaseName string) {
+	hash, err := cache.HashFile(path.Join(outDir, targetBaseName+".a"))
+	if err != nil {
+		panic(err)
+	}
+
+	archiveHashes[targetBaseName] = hash
+}
+
+// testResultKey returns the cache key for a passing run of the supplied test
+// runner, which must already have been linked, from the supplied directory
+// with the supplied arguments and the current environment. See
+// cache.RunnerResultKey.
+func testResultKey(runnerName string, dir string, args []string) string {
+	runner := path.Join(outDir, runnerName)
+	key, err := cache.RunnerResultKey(runner, dir, args, os.Environ())
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+func testResultFile(runnerName string) string {
+	return path.Join(outDir, runnerName+".output")
+}
+
+// lookUpTestResult returns the output of the passing run of the tests cached
+// under the key, if any.
+func lookUpTestResult(key string, runnerName string) (output string, ok bool) {
+	file := testResultFile(runnerName)
+	if !buildCache.Get(key, map[string]string{"output": file}) {
+		return "", false
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+
+	return string(contents), true
+}
+
+// recordTestResult caches the output of a passing run of the tests under the
+// key, so that it can be replayed later.
+func recordTestResult(key string, runnerName string, output string) {
+	file := testResultFile(runnerName)
+	err := ioutil.WriteFile(file, strings.Bytes(output), 0600)
+	if err == nil {
+		err = buildCache.Put(key, map[string]string{"output": file})
+	}
+
+	if err != nil {
+		fmt.Printf("Warning: couldn't cache the result for %s: %s\n", runnerName, err)
+	}
+}
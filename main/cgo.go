@@ -0,0 +1,198 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"container/vector"
+	"fmt"
+	"igo/build"
+	"igo/set"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// Flags passed to gcc for each target architecture.
+var gccArchFlags = map[string][]string{
+	"amd64": []string{"-m64"},
+	"386":   []string{"-m32"},
+	"arm":   []string{},
+}
+
+// runCgo processes the cgo files of the supplied package. cgo translates them
+// into Go files and C files, and the C files meant for the system C compiler
+// are built with gcc, along with the package's own C files (cFiles), into a
+// single object. The package directory is on the include path, so that
+// headers kept alongside the package's source can be included. The Go files,
+// along with the remaining C files and the object, must then be built into the
+// package with compileFiles. If there are no cgo files, both sets are empty. ok
+// is false if any step fails.
+func runCgo(
+	packageName string,
+	cgoFiles *set.StringSet,
+	cFiles *set.StringSet) (goFiles *set.StringSet, otherFiles *set.StringSet, ok bool) {
+	goFiles = &set.StringSet{}
+	otherFiles = &set.StringSet{}
+
+	cgoFileNames := cgoFiles.Sorted()
+	if len(cgoFileNames) == 0 {
+		return goFiles, otherFiles, true
+	}
+
+	outputDir := path.Join(outDir, "_cgo/"+packageName)
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		panic(err)
+	}
+
+	goos := os.Getenv("GOOS")
+	goarch := os.Getenv("GOARCH")
+
+	// The tools run from within the output directory, so refer to the package
+	// directory relative to it.
+	packageDir := build.RelativePath(
+		path.Join(projectRoot, outputDir),
+		path.Join(projectRoot, packageName))
+
+	// Write copies of the files without their #cgo directives, collecting the
+	// flags that they set.
+	var cflags vector.StringVector
+	cflags.AppendVector(&[]string{"-I", packageDir})
+	var ldflags vector.StringVector
+	var baseNames vector.StringVector
+
+	for _, file := range cgoFileNames {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		directives, stripped, err := build.ParseCgoDirectives(string(contents), goos, goarch)
+		if err != nil {
+			fmt.Printf("%s: %s\n", userPath(file), err)
+			return goFiles, otherFiles, false
+		}
+
+		cflags.AppendVector(&directives.CFlags)
+		ldflags.AppendVector(&directives.LDFlags)
+
+		_, baseName := path.Split(file)
+		writeFile(path.Join(outputDir, baseName), stripped)
+		baseNames.Push(baseName[0 : len(baseName)-len(".go")])
+	}
+
+	// Run cgo over the copies, from within the output directory.
+	cgoPath := path.Join(os.Getenv("GOBIN"), "cgo")
+
+	var cgoArgs vector.StringVector
+	cgoArgs.Push("--")
+	cgoArgs.AppendVector(&cflags)
+	for _, baseName := range baseNames.Data() {
+		cgoArgs.Push(baseName + ".go")
+	}
+
+	if !executeCommand(cgoPath, cgoArgs.Data(), outputDir) {
+		return goFiles, otherFiles, false
+	}
+
+	// Compile the C files meant for gcc.
+	var gccSources vector.StringVector
+	for _, baseName := range baseNames.Data() {
+		gccSources.Push(baseName + ".cgo2.c")
+	}
+
+	gccSources.Push("_cgo_export.c")
+
+	for _, file := range cFiles.Sorted() {
+		_, baseName := path.Split(file)
+		gccSources.Push(path.Join(packageDir, baseName))
+	}
+
+	var gccObjects vector.StringVector
+	for _, source := range gccSources.Data() {
+		_, baseName := path.Split(source)
+		object := baseName[0:len(baseName)-len(".c")] + ".o"
+		gccObjects.Push(object)
+
+		var args vector.StringVector
+		args.AppendVector(&[]string{"-fPIC", "-O2", "-g", "-I", ".", "-c"})
+		args.AppendVector(&cflags)
+		args.AppendVector(&[]string{"-o", object, source})
+		if !runGcc(args.Data(), outputDir) {
+			return goFiles, otherFiles, false
+		}
+	}
+
+	// Link a throwaway binary, from which cgo determines the symbols that the
+	// package needs from dynamic libraries.
+	var mainArgs vector.StringVector
+	mainArgs.AppendVector(&[]string{"-fPIC", "-O2", "-g", "-I", ".", "-c"})
+	mainArgs.AppendVector(&cflags)
+	mainArgs.AppendVector(&[]string{"-o", "_cgo_main.o", "_cgo_main.c"})
+	if !runGcc(mainArgs.Data(), outputDir) {
+		return goFiles, otherFiles, false
+	}
+
+	var linkArgs vector.StringVector
+	linkArgs.AppendVector(&[]string{"-o", "_cgo_.o", "_cgo_main.o"})
+	linkArgs.AppendVector(&gccObjects)
+	linkArgs.AppendVector(&ldflags)
+	if !runGcc(linkArgs.Data(), outputDir) {
+		return goFiles, otherFiles, false
+	}
+
+	fmt.Printf("%s -dynimport _cgo_.o\n", cgoPath)
+	imports, ok := captureCommand(cgoPath, []string{"-dynimport", "_cgo_.o"}, outputDir)
+	if !ok {
+		return goFiles, otherFiles, false
+	}
+
+	writeFile(path.Join(outputDir, "_cgo_import.c"), imports)
+
+	// Combine the gcc objects into one, to be packed into the archive.
+	var combineArgs vector.StringVector
+	combineArgs.AppendVector(&[]string{"-o", "_all.o", "-nostdlib", "-Wl,-r"})
+	combineArgs.AppendVector(&gccObjects)
+	if !runGcc(combineArgs.Data(), outputDir) {
+		return goFiles, otherFiles, false
+	}
+
+	goFiles.Insert(path.Join(outputDir, "_cgo_gotypes.go"))
+	for _, baseName := range baseNames.Data() {
+		goFiles.Insert(path.Join(outputDir, baseName+".cgo1.go"))
+	}
+
+	otherFiles.Insert(path.Join(outputDir, "_cgo_defun.c"))
+	otherFiles.Insert(path.Join(outputDir, "_cgo_import.c"))
+	otherFiles.Insert(path.Join(outputDir, "_all.o"))
+
+	return goFiles, otherFiles, true
+}
+
+// runGcc runs the system C compiler ($CC, or gcc by default) from the supplied
+// directory with flags for the target architecture and the supplied arguments,
+// returning false if it fails. The program exits if there is no C compiler.
+func runGcc(args []string, dir string) bool {
+	gccPath := os.Getenv("CC")
+	if gccPath == "" {
+		gccPath = "gcc"
+	}
+
+	if !strings.HasPrefix(gccPath, "/") {
+		gccPath = findExecutable(gccPath)
+	}
+
+	if gccPath == "" {
+		fmt.Println("Could not find a C compiler to build cgo files.")
+		fmt.Println("Please ensure that gcc is in $PATH, or that $CC is set.")
+		os.Exit(1)
+	}
+
+	var fullArgs vector.StringVector
+	archFlags := gccArchFlags[os.Getenv("GOARCH")]
+	fullArgs.AppendVector(&archFlags)
+	fullArgs.AppendVector(&args)
+
+	return executeCommand(gccPath, fullArgs.Data(), dir)
+}
@@ -0,0 +1,304 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"container/vector"
+	"flag"
+	"fmt"
+	"igo/cover"
+	"igo/set"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+var coverMode = flag.Bool(
+	"cover",
+	false,
+	"Instrument the packages under test and report their statement coverage.")
+
+var coverPackages = flag.String(
+	"coverpkg",
+	"",
+	"Comma-separated list of packages to instrument for coverage instead of "+
+		"the packages under test. Patterns such as ./... are allowed. Implies "+
+		"-cover.")
+
+var coverProfile = flag.String(
+	"coverprofile",
+	"",
+	"Write a coverage profile, merged across all of the packages tested, to "+
+		"this file. Implies -cover.")
+
+var coverHTML = flag.String(
+	"coverhtml",
+	"",
+	"Write an HTML page showing the source of the instrumented packages, "+
+		"annotated with coverage, to this file. Implies -cover.")
+
+var coverMin = flag.Float64(
+	"covermin",
+	0,
+	"Fail if the total statement coverage, as a percentage, is below this "+
+		"value. Implies -cover.")
+
+// The name of the package holding the coverage counters, within igo-out.
+const counterPackageName = "_igocover"
+
+// The blocks instrumented in every covered package, in counter order, and
+// whether each has been covered by any test runner so far.
+var coverBlocks vector.Vector // Of cover.Block
+var coveredBlocks []bool
+
+// The range of counters belonging to each covered package.
+type counterRange struct {
+	start int
+	limit int
+}
+
+var coverRanges = make(map[string]counterRange)
+
+// The covered packages, in the order in which they were instrumented.
+var coverOrder vector.StringVector
+
+// The original source of each instrumented file.
+var coverSources = make(map[string]string)
+
+// coverageRequested returns true if any of the coverage flags were given.
+func coverageRequested() bool {
+	return *coverMode ||
+		*coverPackages != "" ||
+		*coverProfile != "" ||
+		*coverHTML != "" ||
+		*coverMin > 0
+}
+
+// setUpCoverage instruments the non-test files of the packages to be covered,
+// replacing them in requiredFiles, and compiles the package holding the
+// counters. It must be called before any packages in totalOrder are compiled.
+func setUpCoverage(
+	specifiedPackages []string,
+	totalOrder []string,
+	requiredFiles map[string]*set.StringSet,
+	packageDeps map[string]*set.StringSet) {
+	var wanted set.StringSet
+	if *coverPackages == "" {
+		for _, packageName := range specifiedPackages {
+			wanted.Insert(packageName)
+		}
+	} else {
+		for _, packageName := range resolvePackageArgs(splitCommaList(*coverPackages)) {
+			wanted.Insert(packageName)
+		}
+	}
+
+	for _, packageName := range totalOrder {
+		if wanted.Contains(packageName) {
+			instrumentPackage(packageName, requiredFiles[packageName])
+			packageDeps[packageName].Insert(counterPackageName)
+		}
+	}
+
+	coveredBlocks = make([]bool, coverBlocks.Len())
+
+	counterFile := path.Join(outDir, counterPackageName+".go")
+	writeFile(counterFile, cover.GenerateCounterPackage(coverBlocks.Len()))
+
+	var files set.StringSet
+	var localDeps set.StringSet
+	files.Insert(counterFile)
+
+	fmt.Printf("\nCompiling coverage counters: %s\n", counterPackageName)
+	if !compileFiles(&files, nil, &localDeps, counterPackageName) {
+		os.Exit(1)
+	}
+}
+
+// instrumentPackage writes instrumented copies of the non-test files in the
+// supplied set into igo-out, and replaces them in the set.
+func instrumentPackage(packageName string, files *set.StringSet) {
+	outputDir := path.Join(outDir, "_cover/"+packageName)
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		panic(err)
+	}
+
+	start := coverBlocks.Len()
+	var result set.StringSet
+
+	for _, file := range files.Sorted() {
+		if strings.HasSuffix(file, "_test.go") {
+			result.Insert(file)
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		name := path.Clean(file)
+		source, blocks, err := cover.Instrument(name, string(contents), coverBlocks.Len())
+		if err != nil {
+			fmt.Printf("Couldn't instrument %s: %s\n", userPath(name), err)
+			os.Exit(1)
+		}
+
+		for _, block := range blocks {
+			coverBlocks.Push(block)
+		}
+
+		_, baseName := path.Split(file)
+		outputFile := path.Join(outputDir, baseName)
+		writeFile(outputFile, source)
+
+		coverSources[name] = string(contents)
+		result.Insert(outputFile)
+	}
+
+	coverRanges[packageName] = counterRange{start, coverBlocks.Len()}
+	coverOrder.Push(packageName)
+
+	*files = result
+}
+
+// coverageHookFile writes the file that makes the supplied test runner record
+// its counters, returning its name.
+func coverageHookFile(runnerName string) string {
+	hookFile := path.Join(outDir, runnerName+"_cover.go")
+	writeFile(hookFile, cover.GenerateRunnerHook(countsFile(runnerName)))
+	return hookFile
+}
+
+// countsFile returns the absolute path of the file to which the supplied test
+// runner writes its counters. It must be absolute because the runner is run
+// from its package's directory.
+func countsFile(runnerName string) string {
+	return path.Join(projectRoot, outDir+"/"+runnerName+".counts")
+}
+
+// collectCoverage reads the counters written by a run of the supplied test
+// runner, merges them into the overall coverage, and reports the coverage of
+// the run. The counters are then deleted so that they can't be read twice.
+func collectCoverage(packageName string, runnerName string) {
+	file := countsFile(runnerName)
+	contents, _ := ioutil.ReadFile(file)
+	os.Remove(file)
+
+	counts := cover.ParseCounts(string(contents), coverBlocks.Len())
+	cover.Merge(coveredBlocks, counts)
+
+	// Report coverage of the package itself, unless other packages were
+	// explicitly chosen for coverage.
+	packages := coverOrder.Data()
+	if *coverPackages == "" {
+		packages = []string{packageName}
+	}
+
+	coveredStmts, totalStmts := coverageOf(packages, counts)
+	fmt.Printf(
+		"coverage: %.1f%% of statements\n",
+		cover.Percentage(coveredStmts, totalStmts))
+}
+
+// coverageOf returns the number of statements in the supplied packages that
+// are covered according to covered, and the total number of statements.
+func coverageOf(packages []string, covered []bool) (coveredStmts int, totalStmts int) {
+	for _, packageName := range packages {
+		r, ok := coverRanges[packageName]
+		if !ok {
+			continue
+		}
+
+		c, t := cover.Summarize(getCoverBlocks(r), covered[r.start:r.limit])
+		coveredStmts += c
+		totalStmts += t
+	}
+
+	return
+}
+
+func getCoverBlocks(r counterRange) []cover.Block {
+	result := make([]cover.Block, r.limit-r.start)
+	for i := range result {
+		result[i] = coverBlocks.At(r.start + i).(cover.Block)
+	}
+
+	return result
+}
+
+// finishCoverage prints the coverage of each covered package across all of the
+// test runners, writes the profile and HTML requested by the flags, and
+// returns false if the total coverage is below the -covermin threshold.
+func finishCoverage() bool {
+	packages := coverOrder.Data()
+
+	fmt.Println("\nCoverage:")
+	for _, packageName := range packages {
+		coveredStmts, totalStmts := coverageOf([]string{packageName}, coveredBlocks)
+		fmt.Printf(
+			"  %5.1f%%  %s\n",
+			cover.Percentage(coveredStmts, totalStmts),
+			packageName)
+	}
+
+	coveredStmts, totalStmts := coverageOf(packages, coveredBlocks)
+	total := cover.Percentage(coveredStmts, totalStmts)
+	fmt.Printf("  %5.1f%%  total\n", total)
+
+	blocks := getCoverBlocks(counterRange{0, coverBlocks.Len()})
+	if *coverProfile != "" {
+		writeFile(userFile(*coverProfile), cover.FormatProfile(blocks, coveredBlocks))
+	}
+
+	if *coverHTML != "" {
+		writeFile(
+			userFile(*coverHTML),
+			cover.RenderHTML(blocks, coveredBlocks, coverSources))
+	}
+
+	if total < *coverMin {
+		fmt.Printf(
+			"Total coverage %.1f%% is below the minimum of %.1f%%.\n",
+			total,
+			*coverMin)
+		return false
+	}
+
+	return true
+}
+
+// userFile converts a file name given in a flag, relative to the user's
+// directory, into one usable from the project root.
+func userFile(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+
+	return path.Join(userDir, name)
+}
+
+// splitCommaList splits a comma-separated list, ignoring empty elements.
+func splitCommaList(s string) []string {
+	var result vector.StringVector
+	for s != "" {
+		end := strings.Index(s, ",")
+		if end < 0 {
+			end = len(s)
+		}
+
+		if end > 0 {
+			result.Push(s[0:end])
+		}
+
+		if end == len(s) {
+			break
+		}
+
+		s = s[end+1:]
+	}
+
+	return result.Data()
+}
@@ -0,0 +1,319 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"container/vector"
+	"flag"
+	"fmt"
+	"igo/build"
+	"igo/cache"
+	"igo/parse"
+	"igo/set"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var importPrefix = flag.String(
+	"importprefix",
+	"",
+	"Import path prefix that refers to the project root, so that e.g. "+
+		"\"igo/set\" refers to the set directory if the prefix is igo. "+
+		"Defaults to the module line of go.mod in the project root, if any.")
+
+var sourceRoots = flag.String(
+	"srcroots",
+	"",
+	"Comma-separated list of directories within the project, relative to "+
+		"its root or absolute, holding the source of third-party packages by "+
+		"import path. They are searched after any vendor directories.")
+
+var scanCache = flag.Bool(
+	"scancache",
+	true,
+	"Keep the parsed form of source files in igo-out between runs, so that "+
+		"files that haven't changed aren't read and parsed again.")
+
+// How imports map to the project's packages.
+var importConfig build.ImportConfig
+
+// The name of the file within igo-out holding the parsed form of source files.
+const scanCacheFile = "_scan.gob"
+
+// The directory within igo-out from which the compiler and linker find
+// packages imported by paths other than relative ones.
+const importDir = "_import"
+
+// The packages referred to by import paths other than relative ones, and the
+// reverse mapping.
+var importedPackages = make(map[string]string)
+var packageImportPaths = make(map[string]*vector.StringVector)
+
+// initImportConfig sets up importConfig according to the flags and the
+// project's go.mod file, exiting the program if the latter can't be read or a
+// source root is outside the project.
+func initImportConfig() {
+	var roots vector.StringVector
+	for _, root := range splitCommaList(*sourceRoots) {
+		dir, err := build.SourceRootDir(projectRoot, root)
+		if err != nil {
+			fmt.Printf("Invalid -srcroots: %s\n", err)
+			os.Exit(1)
+		}
+
+		roots.Push(dir)
+	}
+
+	importConfig.SourceRoots = roots.Data()
+
+	importConfig.FileCache = parse.NewFileCache()
+	if *scanCache {
+		importConfig.FileCache = parse.LoadFileCache(path.Join(outDir, scanCacheFile))
+	}
+
+	importConfig.Prefix = *importPrefix
+	if importConfig.Prefix != "" {
+		return
+	}
+
+	prefix, err := build.ReadImportPrefix(projectRoot)
+	if err != nil {
+		fmt.Printf("Couldn't read %s: %s\n", userPath(build.ModuleFile), err)
+		os.Exit(1)
+	}
+
+	importConfig.Prefix = prefix
+}
+
+// saveScanCache writes the parsed form of the source files scanned by this run
+// into igo-out, if requested, for the next run to use.
+func saveScanCache() {
+	if !*scanCache {
+		return
+	}
+
+	file := path.Join(outDir, scanCacheFile)
+	if err := importConfig.FileCache.Save(file); err != nil {
+		fmt.Printf("Couldn't save %s: %s\n", userPath(file), err)
+	}
+}
+
+// recordResolvedImports records the packages that the supplied package's
+// non-relative imports refer to, so that they can be exposed under their
+// import paths with exposeArchive. It exits the program if an import path
+// refers to different packages for different importers, as when two vendor
+// directories hold the same package.
+func recordResolvedImports(importer string, dirInfo build.DirectoryInfo) {
+	var importPaths set.StringSet
+	for importPath, _ := range dirInfo.ResolvedImports {
+		importPaths.Insert(importPath)
+	}
+
+	for _, importPath := range importPaths.Sorted() {
+		packageName := dirInfo.ResolvedImports[importPath]
+		existing, ok := importedPackages[importPath]
+		if ok && existing != packageName {
+			fmt.Printf(
+				"Import %s refers to both %s and %s (imported by %s).\n",
+				strconv.Quote(importPath),
+				userPath(existing),
+				userPath(packageName),
+				userPath(importer))
+			fmt.Println("A package can only be vendored once per build.")
+			os.Exit(1)
+		}
+
+		if !ok {
+			importedPackages[importPath] = packageName
+			if packageImportPaths[packageName] == nil {
+				packageImportPaths[packageName] = new(vector.StringVector)
+			}
+
+			packageImportPaths[packageName].Push(importPath)
+		}
+	}
+}
+
+// importPathArgs returns the arguments with which the compiler or linker (as
+// given by flagName) finds packages imported by non-relative paths.
+func importPathArgs(flagName string) []string {
+	if len(importedPackages) == 0 {
+		return []string{}
+	}
+
+	return []string{flagName, importDir}
+}
+
+// exposeArchive makes the archive for the supplied package, which must already
+// have been compiled, available to the compiler and linker under each of the
+// non-relative import paths that refer to it.
+func exposeArchive(packageName string) {
+	importPaths, ok := packageImportPaths[packageName]
+	if !ok {
+		return
+	}
+
+	src := path.Join(outDir, packageName+".a")
+	for _, importPath := range importPaths.Data() {
+		dst := path.Join(outDir, importDir+"/"+importPath+".a")
+		if err := cache.CopyFile(src, dst); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// rewriteImports writes copies of those of the supplied package's files that
+// contain imports the compiler can't find as written into igo-out, with the
+// imports replaced according to paths (see build.DirectoryInfo.RewrittenImports),
+// and replaces them in files.
+func rewriteImports(packageName string, files *set.StringSet, paths map[string]string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	outputDir := path.Join(outDir, "_rewrite/"+packageName)
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		panic(err)
+	}
+
+	var result set.StringSet
+	for _, file := range files.Sorted() {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		source := parse.RewriteImports(string(contents), paths)
+		if source == string(contents) {
+			result.Insert(file)
+			continue
+		}
+
+		_, baseName := path.Split(file)
+		outputFile := path.Join(outputDir, baseName)
+		writeFile(outputFile, source)
+		result.Insert(outputFile)
+	}
+
+	*files = result
+}
+
+// checkTargetEnvironment exits the program if $GOROOT, $GOOS or $GOARCH isn't
+// set, or $GOARCH isn't a known architecture, since neither the standard library
+// nor the tools can be found without them.
+func checkTargetEnvironment() {
+	for _, name := range []string{"GOROOT", "GOOS", "GOARCH"} {
+		if os.Getenv(name) == "" {
+			fmt.Printf("$%s isn't set.\n", name)
+			fmt.Println("Please ensure that $GOROOT, $GOOS and $GOARCH are set.")
+			os.Exit(1)
+		}
+	}
+
+	if _, ok := compilers[os.Getenv("GOARCH")]; !ok {
+		fmt.Printf("Unknown $GOARCH: %s\n", os.Getenv("GOARCH"))
+		os.Exit(1)
+	}
+}
+
+// verifyImports checks that every package imported from outside the project by
+// the supplied packages can be found by the compiler, either in the standard
+// library of the toolchain, in the -pkgdir directory, or in a directory given
+// to the compiler with -I in -gcflags. Imports by test files are checked for
+// the packages in testedPackages. All unresolved imports are reported, and the
+// program exits if there are any.
+func verifyImports(
+	packages []string,
+	dirInfos map[string]build.DirectoryInfo,
+	testedPackages *set.StringSet) {
+	found := make(map[string]bool)
+	var unresolved vector.StringVector
+
+	for _, packageName := range packages {
+		searchDirs := importSearchDirs(compilerFlags.argsFor(packageName))
+
+		for _, site := range dirInfos[packageName].ExternalImports {
+			if site.InTest && !testedPackages.Contains(packageName) {
+				continue
+			}
+
+			key := site.Path + "\x00" + strings.Join(searchDirs, "\x00")
+			exists, ok := found[key]
+			if !ok {
+				exists = archiveExists(site.Path, searchDirs)
+				found[key] = exists
+			}
+
+			if !exists {
+				unresolved.Push(fmt.Sprintf(
+					"%s:%d: can't find import %s",
+					userPath(site.File),
+					site.Line,
+					strconv.Quote(site.Path)))
+			}
+		}
+	}
+
+	if unresolved.Len() == 0 {
+		return
+	}
+
+	fmt.Println("Unresolved imports:")
+	for _, message := range unresolved.Data() {
+		fmt.Printf("  %s\n", message)
+	}
+
+	os.Exit(1)
+}
+
+// importSearchDirs returns the directories in which the compiler looks for
+// imported archives, given the extra arguments passed to it.
+func importSearchDirs(compilerArgs []string) []string {
+	var result vector.StringVector
+
+	target := os.Getenv("GOOS") + "_" + os.Getenv("GOARCH")
+	result.Push(path.Join(os.Getenv("GOROOT"), "pkg/"+target))
+
+	if *pkgDir != "" {
+		result.Push(getInstallDir(*pkgDir, "", "pkgdir"))
+	}
+
+	for i := 0; i < len(compilerArgs); i++ {
+		dir := ""
+		switch {
+		case compilerArgs[i] == "-I" && i+1 < len(compilerArgs):
+			i++
+			dir = compilerArgs[i]
+		case strings.HasPrefix(compilerArgs[i], "-I"):
+			dir = compilerArgs[i][2:]
+		default:
+			continue
+		}
+
+		// The compiler runs from within igo-out.
+		if !strings.HasPrefix(dir, "/") {
+			dir = path.Join(outDir, dir)
+		}
+
+		result.Push(dir)
+	}
+
+	return result.Data()
+}
+
+// archiveExists returns true if the archive for the supplied import path is in
+// any of the supplied directories.
+func archiveExists(importPath string, dirs []string) bool {
+	for _, dir := range dirs {
+		d, err := os.Stat(path.Join(dir, importPath+".a"))
+		if err == nil && d.IsRegular() {
+			return true
+		}
+	}
+
+	return false
+}
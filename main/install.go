@@ -0,0 +1,84 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"igo/build"
+	"igo/cache"
+	"os"
+	"path"
+	"strings"
+)
+
+var binDir = flag.String(
+	"bindir",
+	"",
+	"Directory into which igo install copies binaries. Defaults to $GOBIN.")
+
+var pkgDir = flag.String(
+	"pkgdir",
+	"",
+	"Directory into which igo install copies package archives. Defaults to "+
+		"$GOROOT/pkg/$GOOS_$GOARCH.")
+
+// getInstallDir returns the value of the supplied flag if it is set, and
+// otherwise the default. It exits the program if neither is available.
+func getInstallDir(flagValue string, defaultValue string, flagName string) string {
+	if flagValue != "" {
+		// Flags are given relative to the user's directory, not the project root.
+		if !strings.HasPrefix(flagValue, "/") {
+			return path.Join(userDir, flagValue)
+		}
+
+		return flagValue
+	}
+
+	if defaultValue == "" {
+		fmt.Printf("Could not determine where to install to.\n")
+		fmt.Printf("Please pass -%s or set the appropriate environment variables.\n", flagName)
+		os.Exit(1)
+	}
+
+	return defaultValue
+}
+
+// installPackage copies the built output for the named package out of
+// igo-out. Binaries are copied into the bin directory under the last component
+// of the package name, and library archives are copied into the pkg directory
+// under the full package name, preceded by the import prefix if there is one,
+// so that other projects can import them by the same paths as the project.
+func installPackage(packageName string, dirInfo build.DirectoryInfo) {
+	var src, dst string
+
+	if dirInfo.PackageName == "main" {
+		dir := getInstallDir(*binDir, os.Getenv("GOBIN"), "bindir")
+		_, binaryName := path.Split(packageName)
+
+		src = path.Join(outDir, packageName)
+		dst = path.Join(dir, binaryName)
+	} else {
+		defaultDir := ""
+		if os.Getenv("GOROOT") != "" && os.Getenv("GOOS") != "" && os.Getenv("GOARCH") != "" {
+			defaultDir = path.Join(
+				os.Getenv("GOROOT"),
+				"pkg/"+os.Getenv("GOOS")+"_"+os.Getenv("GOARCH"))
+		}
+
+		dir := getInstallDir(*pkgDir, defaultDir, "pkgdir")
+		if importConfig.Prefix != "" {
+			dir = path.Join(dir, importConfig.Prefix)
+		}
+
+		src = path.Join(outDir, packageName+".a")
+		dst = path.Join(dir, packageName+".a")
+	}
+
+	fmt.Printf("Installing %s to %s\n", src, dst)
+	if err := cache.CopyFile(src, dst); err != nil {
+		fmt.Printf("Error installing %s: %s\n", packageName, err)
+		os.Exit(1)
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"igo/build"
 	"igo/deps"
 	"igo/set"
-	"igo/test"
-	"io/ioutil"
 	"os"
 	"path"
 	"strings"
@@ -48,9 +46,9 @@ var compilers = map[string]string {
 	"arm": "5g",
 }
 
-// compileFiles invokes 6g with the appropriate arguments for compiling the
-// supplied set of .go files, and exits the program if the subprocess fails.
-func compileFiles(files *set.StringSet, targetBaseName string) {
+// getCompilerPaths returns the paths to the compiler and archiver for the
+// target architecture, exiting the program if they can't be determined.
+func getCompilerPaths() (compilerPath string, gopackPath string) {
 	compilerName, ok := compilers[os.Getenv("GOARCH")]
 	if !ok {
 		fmt.Println("Could not determine the correct compiler to run.")
@@ -58,25 +56,108 @@ func compileFiles(files *set.StringSet, targetBaseName string) {
 		os.Exit(1)
 	}
 
-	compilerPath := path.Join(os.Getenv("GOBIN"), compilerName)
-	gopackPath := path.Join(os.Getenv("GOBIN"), "gopack")
+	compilerPath = path.Join(os.Getenv("GOBIN"), compilerName)
+	gopackPath = path.Join(os.Getenv("GOBIN"), "gopack")
+	return
+}
+
+// compileFiles invokes 6g with the appropriate arguments for compiling the
+// supplied set of .go files, along with any arguments given for the target in
+// -gcflags. It returns false if any of the subprocesses fail.
+//
+// otherFiles, which may be nil, holds further files to be packed into the
+// target's archive along with the compiled Go code: .s files are assembled,
+// and .o files are packed as they are. The only .c files are those that cgo
+// generates for the Plan 9 C compiler, which compiles them; the package's own
+// .c files are built with gcc by runCgo, and arrive here in its .o file.
+//
+// localDeps must contain the local packages that the files import, all of
+// which must already have been compiled. If the build cache holds the output
+// for the same inputs, it is restored instead of running the compiler.
+func compileFiles(
+	files *set.StringSet,
+	otherFiles *set.StringSet,
+	localDeps *set.StringSet,
+	targetBaseName string) bool {
+	compilerPath, gopackPath := getCompilerPaths()
+
+	if otherFiles == nil {
+		otherFiles = &set.StringSet{}
+	}
 
 	targetDir, _ := path.Split(targetBaseName)
 	if targetDir != "" {
-		os.MkdirAll(path.Join("igo-out", targetDir), 0700)
+		os.MkdirAll(path.Join(outDir, targetDir), 0700)
 	}
 
-	// Compile
+	cacheFiles := map[string]string{
+		"object":  path.Join(outDir, targetBaseName+".6"),
+		"archive": path.Join(outDir, targetBaseName+".a"),
+	}
+
+	// Each of the other files becomes an object of its own, which must also be
+	// passed to the linker if this is a binary. Objects that we build are
+	// cached along with the archive.
+	otherFileNames := otherFiles.Sorted()
+	objects := make([]string, len(otherFileNames))
+	for i, file := range otherFileNames {
+		if path.Ext(file) == ".o" {
+			objects[i] = path.Join("../", file)
+			continue
+		}
+
+		objects[i] = objectName(targetBaseName, file)
+		cacheFiles[fmt.Sprintf("object%d", i)] = path.Join(outDir, objects[i])
+	}
+
+	extraObjects[targetBaseName] = objects
+	extraArgs := compilerFlags.argsFor(targetBaseName)
+
 	var compilerArgs vector.StringVector
 	compilerArgs.Push("-o")
 	compilerArgs.Push(targetBaseName + ".6")
+	compilerArgs.AppendVector(&extraArgs)
+
+	importArgs := importPathArgs("-I")
+	compilerArgs.AppendVector(&importArgs)
 
-	for file := range files.Iter() {
+	for _, file := range files.Sorted() {
 		compilerArgs.Push(path.Join("../", file))
 	}
 
-	if !executeCommand(compilerPath, compilerArgs.Data(), "igo-out/") {
-		os.Exit(1)
+	cacheKey := ""
+	if buildCache != nil {
+		cacheKey = compileKey(compilerArgs.Data(), files, otherFiles, localDeps)
+		step := buildTrace.Start("restore", targetBaseName, 0)
+		if buildCache.Get(cacheKey, cacheFiles) {
+			buildTrace.Finish(step)
+			fmt.Printf("Restored %s from the build cache.\n", targetBaseName)
+			recordArchiveHash(targetBaseName)
+			return true
+		}
+	}
+
+	// Compile
+	if !executeStep("compile", targetBaseName, compilerPath, compilerArgs.Data(), outDir+"/") {
+		return false
+	}
+
+	// Assemble and compile C
+	for i, file := range otherFileNames {
+		if path.Ext(file) == ".o" {
+			continue
+		}
+
+		toolPath, toolArgs := objectTool(file)
+		var args vector.StringVector
+		args.Push("-o")
+		args.Push(objects[i])
+		args.AppendVector(&toolArgs)
+		args.Push(path.Join("../", file))
+
+		if !executeStep("assemble", targetBaseName, toolPath, args.Data(), outDir+"/") {
+			return false
+		}
 	}
 
 	// Pack
@@ -84,10 +165,75 @@ func compileFiles(files *set.StringSet, targetBaseName string) {
 	gopackArgs.Push("grc")
 	gopackArgs.Push(targetBaseName + ".a")
 	gopackArgs.Push(targetBaseName + ".6")
+	gopackArgs.AppendVector(&objects)
+
+	if !executeStep("pack", targetBaseName, gopackPath, gopackArgs.Data(), outDir+"/") {
+		return false
+	}
+
+	if buildCache != nil {
+		if err := buildCache.Put(cacheKey, cacheFiles); err != nil {
+			fmt.Printf("Warning: couldn't store %s in the build cache: %s\n",
+				targetBaseName, err)
+		}
+	}
+
+	recordArchiveHash(targetBaseName)
+	return true
+}
 
-	if !executeCommand(gopackPath, gopackArgs.Data(), "igo-out/") {
+// Objects other than the compiled Go code that make up each target compiled by
+// compileFiles, relative to igo-out.
+var extraObjects = make(map[string][]string)
+
+// objectName returns the name, relative to igo-out, of the object to which the
+// supplied .s or .c file is built when building the supplied target.
+func objectName(targetBaseName string, file string) string {
+	_, baseName := path.Split(file)
+	return targetBaseName + "." + baseName[0:len(baseName)-len(path.Ext(baseName))] + ".6"
+}
+
+var assemblers = map[string]string{
+	"amd64": "6a",
+	"386":   "8a",
+	"arm":   "5a",
+}
+
+var cCompilers = map[string]string{
+	"amd64": "6c",
+	"386":   "8c",
+	"arm":   "5c",
+}
+
+// objectTool returns the path to the tool that builds the supplied .s or .c
+// file into an object for the target architecture, and any arguments it needs
+// other than the output and input files. It exits the program if the tool
+// can't be determined.
+func objectTool(file string) (toolPath string, args []string) {
+	tools := assemblers
+	if path.Ext(file) == ".c" {
+		// The C files come from cgo, and include headers from the runtime and
+		// from their own directories.
+		tools = cCompilers
+		target := os.Getenv("GOOS") + "_" + os.Getenv("GOARCH")
+		dir, _ := path.Split(file)
+		args = []string{
+			"-FVw",
+			"-I", path.Join("../", dir),
+			"-I", path.Join(os.Getenv("GOROOT"), "pkg/"+target),
+			"-I", path.Join(os.Getenv("GOROOT"), "src/pkg/runtime"),
+		}
+	}
+
+	toolName, ok := tools[os.Getenv("GOARCH")]
+	if !ok {
+		fmt.Printf("Could not determine the correct tool to build %s.\n", file)
+		fmt.Println("Please ensure that $GOARCH is set.")
 		os.Exit(1)
 	}
+
+	toolPath = path.Join(os.Getenv("GOBIN"), toolName)
+	return
 }
 
 var linkers = map[string]string {
@@ -97,8 +243,10 @@ var linkers = map[string]string {
 }
 
 // linkBinary calls 6l to link the binary of the given name, which must have
-// already been compiled with compileFiles.
-func linkBinary(name string) {
+// already been compiled with compileFiles, passing along any arguments given
+// for it in -ldflags. Objects built from other files in the binary's package
+// (see compileFiles) are linked in too. It returns false if the linker fails.
+func linkBinary(name string) bool {
 	linkerName, ok := linkers[os.Getenv("GOARCH")]
 	if !ok {
 		fmt.Println("Could not determine the correct linker to run.")
@@ -111,71 +259,399 @@ func linkBinary(name string) {
 	var linkerArgs vector.StringVector
 	linkerArgs.Push("-o")
 	linkerArgs.Push(name)
+
+	extraArgs := linkerFlags.argsFor(name)
+	linkerArgs.AppendVector(&extraArgs)
+
+	importArgs := importPathArgs("-L")
+	linkerArgs.AppendVector(&importArgs)
 	linkerArgs.Push(name + "." + linkerName[0:1])
 
-	if !executeCommand(linkerPath, linkerArgs.Data(), "igo-out/") {
-		os.Exit(1)
-	}
+	objects := extraObjects[name]
+	linkerArgs.AppendVector(&objects)
+
+	return executeStep("link", name, linkerPath, linkerArgs.Data(), outDir+"/")
 }
 
 func printUsageAndExit() {
 	fmt.Println("Usage:")
-	fmt.Println("  igo build <directory name>")
+	fmt.Println("  igo build <directory name> ...")
+	fmt.Println("  igo test <directory name> ...")
+	fmt.Println("  igo install <directory name> ...")
+	fmt.Println("  igo vendor <import path> ...")
+	fmt.Println()
+	fmt.Println("Flags (which must precede the command):")
+	flag.PrintDefaults()
 	os.Exit(1)
 }
 
+// The directory from which igo was invoked, and the root of the project
+// containing it. Both are absolute paths.
+var userDir string
+var projectRoot string
+
+// The directory, relative to the project root, into which packages are built.
+// Files are given to the tools relative to it, so it must be an immediate
+// child of the project root.
+var outDir = "igo-out"
+
+// toProjectPath converts a path given on the command line, relative to the
+// user's directory, into one relative to the project root. It exits the
+// program if the path is not within the project.
+func toProjectPath(arg string) string {
+	dir := arg
+	if !strings.HasPrefix(dir, "/") {
+		dir = path.Join(userDir, arg)
+	}
+
+	result := build.RelativePath(projectRoot, dir)
+	if result == ".." || strings.HasPrefix(result, "../") {
+		fmt.Printf("Not a directory within the project rooted at %s: %s\n",
+			userPath(""), arg)
+		os.Exit(1)
+	}
+
+	return result
+}
+
+// resolvePackageArgs converts the directories given on the command line into
+// package names relative to the project root. An argument of the form
+// "dir/..." matches every package directory at or beneath dir.
+func resolvePackageArgs(args []string) []string {
+	var result vector.StringVector
+	var seen set.StringSet
+
+	for _, arg := range args {
+		var packageNames []string
+
+		if arg == "..." || strings.HasSuffix(arg, "/...") {
+			dir := toProjectPath(arg[0 : len(arg)-len("...")])
+			packageNames = build.FindPackageDirs(dir, scanJobCount())
+			if len(packageNames) == 0 {
+				fmt.Printf("Warning: %s matched no packages.\n", arg)
+			}
+		} else {
+			packageName := toProjectPath(arg)
+			if packageName == "." {
+				fmt.Printf("The project root can't be built as a package: %s\n", arg)
+				os.Exit(1)
+			}
+
+			packageNames = []string{packageName}
+		}
+
+		for _, packageName := range packageNames {
+			if packageName != "." && !seen.Contains(packageName) {
+				seen.Insert(packageName)
+				result.Push(packageName)
+			}
+		}
+	}
+
+	return result.Data()
+}
+
+// userPath converts a path relative to the project root into one relative to
+// the directory the user invoked igo from, for use in diagnostics.
+func userPath(name string) string {
+	return build.RelativePath(userDir, path.Join(projectRoot, name))
+}
+
+// resetOutDir creates an empty outDir, deleting the old one first.
+func resetOutDir() {
+	os.RemoveAll(outDir)
+	os.Mkdir(outDir, 0700)
+}
+
+var keepGoing = flag.Bool(
+	"k",
+	false,
+	"Keep going after a package fails to build, building every package whose "+
+		"dependencies built successfully.")
+
+// buildPackages builds the packages in totalOrder into outDir, given the
+// information gathered about them. The binaries among the specified packages
+// are linked, and if the command is test, their test runners are built. The
+// sets in requiredFiles and otherFiles are modified to hold the generated files
+// built along with each package.
+//
+// If a package fails to build, the program exits, unless -k was given. In
+// that case the packages that depend on it are skipped, everything else is
+// built, and the failed and skipped packages are listed at the end. The
+// returned set holds the packages that failed or were skipped, including those
+// whose binary or test runner failed to build.
+func buildPackages(
+	command string,
+	specifiedPackages []string,
+	totalOrder []string,
+	dirInfos map[string]build.DirectoryInfo,
+	requiredFiles map[string]*set.StringSet,
+	otherFiles map[string]*set.StringSet,
+	packageDeps map[string]*set.StringSet) *set.StringSet {
+	var failed set.StringSet
+	var skipped set.StringSet
+
+	// Rewrite the imports that the compiler can't find as written.
+	for _, packageName := range totalOrder {
+		rewriteImports(
+			packageName,
+			requiredFiles[packageName],
+			dirInfos[packageName].RewrittenImports)
+	}
+
+	// Stamp the main packages being built with the project's revision.
+	if *stampVar != "" && command != "test" {
+		for _, packageName := range specifiedPackages {
+			if dirInfos[packageName].PackageName == "main" {
+				requiredFiles[packageName].Insert(writeStampFile(packageName))
+			}
+		}
+	}
+
+	// If we're measuring coverage, instrument the packages to be covered.
+	if command == "test" && coverageRequested() {
+		setUpCoverage(specifiedPackages, totalOrder, requiredFiles, packageDeps)
+	}
+
+	// Compile each of the packages in turn, skipping those with dependencies
+	// that didn't build.
+	for _, currentPackage := range totalOrder {
+		if dep := brokenDep(packageDeps[currentPackage], &failed, &skipped); dep != "" {
+			fmt.Printf(
+				"\nSkipping package: %s (dependency %s failed to build)\n",
+				currentPackage,
+				dep)
+			skipped.Insert(currentPackage)
+			continue
+		}
+
+		fmt.Printf("\nCompiling package: %s\n", currentPackage)
+
+		// Translate any cgo files into Go and C first.
+		step := buildTrace.Start("cgo", currentPackage, 0)
+		goFiles, cgoOtherFiles, ok := runCgo(
+			currentPackage,
+			dirInfos[currentPackage].CgoFiles,
+			dirInfos[currentPackage].CFiles)
+		if dirInfos[currentPackage].CgoFiles.Len() > 0 {
+			buildTrace.Finish(step)
+		}
+
+		if ok {
+			requiredFiles[currentPackage].Union(goFiles)
+			otherFiles[currentPackage].Union(cgoOtherFiles)
+
+			ok = compileFiles(
+				requiredFiles[currentPackage],
+				otherFiles[currentPackage],
+				packageDeps[currentPackage],
+				currentPackage)
+		}
+
+		if !ok {
+			buildFailed(currentPackage, &failed)
+			continue
+		}
+
+		exposeArchive(currentPackage)
+	}
+
+	// If any of the specified packages are binaries, also link them.
+	for _, packageName := range specifiedPackages {
+		if dirInfos[packageName].PackageName != "main" ||
+			failed.Contains(packageName) ||
+			skipped.Contains(packageName) {
+			continue
+		}
+
+		if !linkBinary(packageName) {
+			buildFailed(packageName, &failed)
+		}
+	}
+
+	// If we're testing, create a test runner for each package and build it.
+	if command == "test" {
+		for _, packageName := range specifiedPackages {
+			if failed.Contains(packageName) || skipped.Contains(packageName) {
+				continue
+			}
+
+			ok := buildTestRunner(
+				packageName,
+				dirInfos[packageName],
+				requiredFiles[packageName],
+				otherFiles[packageName],
+				packageDeps[packageName])
+
+			if !ok {
+				buildFailed(packageName, &failed)
+			}
+		}
+	}
+
+	if failed.Len() > 0 {
+		fmt.Println("\nFailed to build:")
+		for _, packageName := range failed.Sorted() {
+			fmt.Printf("  %s\n", packageName)
+		}
+	}
+
+	if skipped.Len() > 0 {
+		fmt.Println("\nSkipped because a dependency failed to build:")
+		for _, packageName := range skipped.Sorted() {
+			fmt.Printf("  %s\n", packageName)
+		}
+	}
+
+	broken := &set.StringSet{}
+	broken.Union(&failed)
+	broken.Union(&skipped)
+	return broken
+}
+
+// buildFailed records that the supplied package failed to build, exiting the
+// program unless -k was given.
+func buildFailed(packageName string, failed *set.StringSet) {
+	if !*keepGoing {
+		os.Exit(1)
+	}
+
+	failed.Insert(packageName)
+}
+
+// brokenDep returns the first of the supplied dependencies, by name, that
+// failed to build or was skipped, or the empty string if there is none.
+func brokenDep(deps *set.StringSet, failed *set.StringSet, skipped *set.StringSet) string {
+	for _, dep := range deps.Sorted() {
+		if failed.Contains(dep) || skipped.Contains(dep) {
+			return dep
+		}
+	}
+
+	return ""
+}
+
 func main() {
 	flag.Parse()
 
-	if flag.NArg() != 2 {
+	if flag.NArg() < 2 {
 		printUsageAndExit()
 	}
 
+	// In JSON mode, standard output is reserved for test events. Everything else
+	// goes to standard error.
+	if *jsonOutput {
+		jsonOut = os.Stdout
+		os.Stdout = os.Stderr
+	}
+
 	command := flag.Arg(0)
-	if command != "build" && command != "test" {
+	if command != "build" &&
+		command != "test" &&
+		command != "install" &&
+		command != "vendor" {
 		printUsageAndExit()
 	}
 
+	if *verifyReproducible && command != "build" {
+		fmt.Println("-verify-reproducible can only be used with igo build.")
+		os.Exit(1)
+	}
+
+	// Find the root of the project, which is where local imports are resolved
+	// from and where igo-out lives, and work from there. The specified packages
+	// are given relative to the directory the user is standing in.
+	var err os.Error
+	userDir, err = os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+
+	projectRoot = build.FindProjectRoot(userDir)
+	if err := os.Chdir(projectRoot); err != nil {
+		panic(err)
+	}
+
+	initImportConfig()
+
+	// Vendoring takes import paths rather than directories, and builds nothing.
+	if command == "vendor" {
+		vendorPackages(flag.Args()[1:])
+		return
+	}
+
+	if projectRoot != userDir {
+		fmt.Printf("Using project root: %s\n", userPath(""))
+	}
+
+	specifiedPackages := resolvePackageArgs(flag.Args()[1:])
+	if len(specifiedPackages) == 0 {
+		fmt.Println("No packages to build.")
+		os.Exit(1)
+	}
+
+	initToolFlags(specifiedPackages)
+
 	// Grab dependency and file information for every local package, starting
-	// with the specified one. We consider a package local if it starts with "./".
-	requiredFiles := make(map[string]*set.StringSet)
-	packageDeps := make(map[string]*set.StringSet)
+	// with the specified ones. We consider a package local if it starts with
+	// "./" or "../" or the import prefix.
+	var specifiedSet set.StringSet
+	for _, packageName := range specifiedPackages {
+		specifiedSet.Insert(packageName)
+	}
 
-	specifiedPackage := flag.Arg(1)
-	var remainingPackages vector.StringVector
-	remainingPackages.Push(specifiedPackage)
+	testedPackages := &set.StringSet{}
+	if command == "test" {
+		testedPackages = &specifiedSet
+	}
 
-	for remainingPackages.Len() > 0 {
-		packageName := remainingPackages.Pop()
+	dirInfos := scanPackages(specifiedPackages, testedPackages)
 
-		// Have we already processed this directory?
-		_, alreadyDone := packageDeps[packageName]
-		if alreadyDone {
-			continue
-		}
+	// Check and record the results in a fixed order, so that the same problem
+	// is reported on every run.
+	var scannedSet set.StringSet
+	for packageName, _ := range dirInfos {
+		scannedSet.Insert(packageName)
+	}
 
-		dir := "./" + packageName
-		dirInfo := build.GetDirectoryInfo(dir)
+	requiredFiles := make(map[string]*set.StringSet)
+	otherFiles := make(map[string]*set.StringSet)
+	packageDeps := make(map[string]*set.StringSet)
+
+	for _, packageName := range scannedSet.Sorted() {
+		dirInfo := dirInfos[packageName]
 		if dirInfo.PackageName == "" {
-			fmt.Printf("Couldn't find .go files to build in directory: %s\n", dir)
+			fmt.Printf(
+				"Couldn't find .go files to build in directory: %s\n",
+				userPath(packageName))
+			os.Exit(1)
+		}
+
+		if dirInfo.Errors.Len() > 0 {
+			for _, message := range dirInfo.Errors.Data() {
+				fmt.Println(message)
+			}
+
 			os.Exit(1)
 		}
 
-		// Stash information about this package, and add its local dependencies to
-		// the queue.
-		requiredFiles[packageName] = dirInfo.Files
-		packageDeps[packageName] = dirInfo.Deps
+		recordResolvedImports(packageName, dirInfo)
 
-		// If we're testing and this is the package under test, also add its test
+		// Stash information about this package. The sets are copied so that
+		// adding test files below doesn't modify dirInfo.
+		requiredFiles[packageName] = &set.StringSet{}
+		requiredFiles[packageName].Union(dirInfo.Files)
+		otherFiles[packageName] = &set.StringSet{}
+		otherFiles[packageName].Union(dirInfo.AsmFiles)
+		packageDeps[packageName] = &set.StringSet{}
+		packageDeps[packageName].Union(dirInfo.Deps)
+
+		// If we're testing and this is a package under test, also add its test
 		// files and dependencies.
-		if packageName == specifiedPackage && command == "test" {
+		if testedPackages.Contains(packageName) {
 			requiredFiles[packageName].Union(dirInfo.TestFiles)
 			packageDeps[packageName].Union(dirInfo.TestDeps)
 		}
-
-		for dep := range packageDeps[packageName].Iter() {
-			remainingPackages.Push(dep)
-		}
 	}
 
 	// Order the packages by their dependencies.
@@ -185,38 +661,79 @@ func main() {
 		fmt.Printf("  %s\n", packageName)
 	}
 
+	// Make sure that the packages imported from outside the project exist
+	// before compiling anything. They are looked for according to the target,
+	// so check that it is set first.
+	checkTargetEnvironment()
+	verifyImports(totalOrder, dirInfos, testedPackages)
+
+	initBuildCache()
+
 	// Create a directory to hold outputs, deleting the old one first.
-	os.RemoveAll("igo-out")
-	os.Mkdir("igo-out", 0700)
+	resetOutDir()
+	saveScanCache()
+
+	// Snapshot the files to be built before building modifies them, so that
+	// they can be built a second time.
+	var verifyFiles, verifyOtherFiles map[string]*set.StringSet
+	if *verifyReproducible {
+		verifyFiles = copySets(requiredFiles)
+		verifyOtherFiles = copySets(otherFiles)
+	}
 
-	// Compile each of the packages in turn.
-	for _, currentPackage := range totalOrder {
-		fmt.Printf("\nCompiling package: %s\n", currentPackage)
-		compileFiles(requiredFiles[currentPackage], currentPackage)
+	broken := buildPackages(
+		command,
+		specifiedPackages,
+		totalOrder,
+		dirInfos,
+		requiredFiles,
+		otherFiles,
+		packageDeps)
+
+	if *verifyReproducible && broken.Len() == 0 {
+		if !verifyReproducibleBuild(
+			specifiedPackages,
+			totalOrder,
+			dirInfos,
+			verifyFiles,
+			verifyOtherFiles,
+			packageDeps) {
+			os.Exit(1)
+		}
 	}
 
-	// If this is a binary, also link it.
-	if build.GetDirectoryInfo(specifiedPackage).PackageName == "main" {
-		linkBinary(specifiedPackage)
+	finishBuildCache()
+
+	// Only the specified packages that built are tested or installed.
+	var builtPackages vector.StringVector
+	for _, packageName := range specifiedPackages {
+		if !broken.Contains(packageName) {
+			builtPackages.Push(packageName)
+		}
 	}
 
-	// If we're testing, create a test runner, build it, and run it.
+	// Run the tests, skipping those whose passing result is cached.
+	passed := broken.Len() == 0
 	if command == "test" {
-		const outputFile = "igo-out/test_runner.go"
-		testFuncs := build.GetDirectoryInfo(specifiedPackage).TestFuncs
-		code := test.GenerateTestMain(specifiedPackage, testFuncs)
-		err := ioutil.WriteFile("igo-out/test_runner.go", strings.Bytes(code), 0600)
-		if err != nil {
-			panic(err)
+		if !runTests(builtPackages.Data(), dirInfos) {
+			passed = false
 		}
 
-		var files set.StringSet
-		files.Insert("igo-out/test_runner.go")
-		compileFiles(&files, "test_runner")
-		linkBinary("test_runner")
+		if coverageRequested() && !finishCoverage() {
+			passed = false
+		}
+	}
 
-		if !executeCommand("igo-out/test_runner", []string{}, "") {
-			os.Exit(1)
+	// If we're installing, copy the binaries and archives into place.
+	if command == "install" {
+		for _, packageName := range builtPackages.Data() {
+			installPackage(packageName, dirInfos[packageName])
 		}
 	}
+
+	reportTiming(totalOrder, packageDeps)
+
+	if !passed {
+		os.Exit(1)
+	}
 }
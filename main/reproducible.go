@@ -0,0 +1,190 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"container/vector"
+	"flag"
+	"fmt"
+	"igo/build"
+	"igo/cache"
+	"igo/set"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+var verifyReproducible = flag.Bool(
+	"verify-reproducible",
+	false,
+	"Build the packages a second time, from a copy of the sources at another "+
+		"path and at a later time, and check that the archives and binaries of "+
+		"the two builds are identical. Disables the build cache.")
+
+// The directory, relative to the project root, holding the copy of the sources
+// from which the second build is made, and its output. Its name begins with an
+// underscore so that patterns like ./... don't match the files within it.
+const verifyDir = "_igo-verify"
+
+// verifyReproducibleBuild copies the project's source tree into verifyDir, so
+// that it is at a different absolute path, and builds the supplied packages
+// again from there as buildPackages did. It then compares the resulting
+// archives and binaries with those in outDir byte for byte, reporting each
+// artifact that differs, and returns false if there are any. requiredFiles and
+// otherFiles must hold the files as they were before the first build.
+func verifyReproducibleBuild(
+	specifiedPackages []string,
+	totalOrder []string,
+	dirInfos map[string]build.DirectoryInfo,
+	requiredFiles map[string]*set.StringSet,
+	otherFiles map[string]*set.StringSet,
+	packageDeps map[string]*set.StringSet) bool {
+	// Make sure that the timestamps of the second build differ from the first.
+	time.Sleep(1e9)
+
+	fmt.Printf(
+		"\nBuilding again from a copy of the sources in %s to verify "+
+			"reproducibility.\n",
+		userPath(verifyDir))
+
+	os.RemoveAll(verifyDir)
+	copySourceTree(verifyDir)
+
+	// Build from within the copy, with the same relative paths as the first
+	// build but a different absolute path.
+	firstRoot := projectRoot
+	projectRoot = path.Join(firstRoot, verifyDir)
+	if err := os.Chdir(projectRoot); err != nil {
+		panic(err)
+	}
+
+	resetOutDir()
+	broken := buildPackages(
+		"build",
+		specifiedPackages,
+		totalOrder,
+		dirInfos,
+		requiredFiles,
+		otherFiles,
+		packageDeps)
+
+	projectRoot = firstRoot
+	if err := os.Chdir(projectRoot); err != nil {
+		panic(err)
+	}
+
+	if broken.Len() > 0 {
+		fmt.Println("The second build failed, so the builds can't be compared.")
+		return false
+	}
+
+	// Compare the archive of every package and the binary of every specified
+	// main package.
+	var artifacts vector.StringVector
+	for _, packageName := range totalOrder {
+		artifacts.Push(packageName + ".a")
+	}
+
+	for _, packageName := range specifiedPackages {
+		if dirInfos[packageName].PackageName == "main" {
+			artifacts.Push(packageName)
+		}
+	}
+
+	fmt.Println("\nReproducibility:")
+	differences := 0
+	for _, artifact := range artifacts.Data() {
+		difference := compareFiles(
+			path.Join(outDir, artifact),
+			path.Join(verifyDir, outDir+"/"+artifact))
+
+		if difference == "" {
+			fmt.Printf("  identical  %s\n", artifact)
+			continue
+		}
+
+		differences++
+		fmt.Printf("  DIFFERENT  %s: %s\n", artifact, difference)
+	}
+
+	if differences > 0 {
+		fmt.Printf(
+			"%d of %d artifacts differ between builds. The second build is in %s.\n",
+			differences,
+			artifacts.Len(),
+			userPath(verifyDir))
+		return false
+	}
+
+	os.RemoveAll(verifyDir)
+	fmt.Printf("All %d artifacts are identical.\n", artifacts.Len())
+	return true
+}
+
+// copySourceTree copies the files within the project root into dst, keeping
+// their layout, so that headers and include directories outside the package
+// directories are copied too. The outputs of igo, in outDir and verifyDir,
+// aren't copied.
+func copySourceTree(dst string) {
+	path.Walk(".", &sourceTreeVisitor{dst}, nil)
+}
+
+type sourceTreeVisitor struct {
+	dst string
+}
+
+func (v *sourceTreeVisitor) VisitDir(dir string, d *os.Dir) bool {
+	return dir != outDir && dir != verifyDir
+}
+
+func (v *sourceTreeVisitor) VisitFile(file string, d *os.Dir) {
+	if !d.IsRegular() {
+		return
+	}
+
+	if err := cache.CopyFile(file, path.Join(v.dst, file)); err != nil {
+		panic(err)
+	}
+}
+
+// compareFiles returns a description of how the contents of the two files
+// differ, or the empty string if they are identical.
+func compareFiles(a string, b string) string {
+	aContents, err := ioutil.ReadFile(a)
+	if err != nil {
+		return fmt.Sprintf("couldn't read %s: %s", userPath(a), err)
+	}
+
+	bContents, err := ioutil.ReadFile(b)
+	if err != nil {
+		return fmt.Sprintf("couldn't read %s: %s", userPath(b), err)
+	}
+
+	for i := 0; i < len(aContents) && i < len(bContents); i++ {
+		if aContents[i] != bContents[i] {
+			return fmt.Sprintf("first difference at byte %d", i)
+		}
+	}
+
+	if len(aContents) != len(bContents) {
+		return fmt.Sprintf(
+			"sizes differ (%d and %d bytes)",
+			len(aContents),
+			len(bContents))
+	}
+
+	return ""
+}
+
+// copySets returns a copy of the supplied map whose sets are also copies.
+func copySets(sets map[string]*set.StringSet) map[string]*set.StringSet {
+	result := make(map[string]*set.StringSet)
+	for key, value := range sets {
+		result[key] = &set.StringSet{}
+		result[key].Union(value)
+	}
+
+	return result
+}
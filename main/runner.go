@@ -0,0 +1,455 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/vector"
+	"flag"
+	"fmt"
+	"igo/build"
+	"igo/parse"
+	"igo/set"
+	"igo/test"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var testTimeout = flag.Int(
+	"timeout",
+	600,
+	"Kill a test runner that has run for longer than this many seconds, after "+
+		"dumping its goroutine stacks. 0 means no limit.")
+
+var slowestTests = flag.Int(
+	"slowest",
+	5,
+	"Number of slowest tests to list after each test runner finishes.")
+
+var jsonOutput = flag.Bool(
+	"json",
+	false,
+	"Report test events as JSON on standard output, one per line. All other "+
+		"output goes to standard error.")
+
+var junitFile = flag.String(
+	"junit",
+	"",
+	"Write a JUnit XML report for all of the packages tested to this file.")
+
+// Where JSON test events are written when -json is set.
+var jsonOut *os.File
+
+// How long to wait for a timed out test runner to dump its stacks and exit
+// before killing it outright, in nanoseconds.
+const stackDumpGracePeriod = 5e9
+
+// testRunnerName returns the target base name of the test runner for the
+// supplied package.
+func testRunnerName(packageName string) string {
+	return packageName + "_test_runner"
+}
+
+// buildTestRunner generates, compiles, and links the test runner for the
+// supplied package, which must already have been compiled along with its test
+// files. files, otherFiles and localDeps must be those that the package was
+// compiled with (see compileFiles), including those of its tests. It returns
+// false if the runner fails to build.
+func buildTestRunner(
+	packageName string,
+	dirInfo build.DirectoryInfo,
+	files *set.StringSet,
+	otherFiles *set.StringSet,
+	localDeps *set.StringSet) bool {
+	runnerName := testRunnerName(packageName)
+	runnerFile := path.Join(outDir, runnerName+".go")
+
+	var runnerFiles set.StringSet
+	var runnerOtherFiles set.StringSet
+	var runnerDeps set.StringSet
+
+	if dirInfo.PackageName == "main" {
+		// A main package can't be imported, so compile its files together with
+		// the test entry point instead.
+		runnerFiles.Union(prepareMainPackageTest(packageName, files))
+		runnerOtherFiles.Union(otherFiles)
+		runnerDeps.Union(localDeps)
+		writeFile(runnerFile, test.GenerateMainPackageTestMain(dirInfo.TestFuncs))
+	} else {
+		runnerDeps.Insert(packageName)
+		writeFile(
+			runnerFile,
+			test.GenerateTestMain(packageName, dirInfo.PackageName, dirInfo.TestFuncs))
+	}
+
+	// Record coverage counters after each test.
+	if coverageRequested() {
+		runnerFiles.Insert(coverageHookFile(runnerName))
+		runnerDeps.Insert(counterPackageName)
+	}
+
+	runnerFiles.Insert(runnerFile)
+	return compileFiles(&runnerFiles, &runnerOtherFiles, &runnerDeps, runnerName) &&
+		linkBinary(runnerName)
+}
+
+// The name given to the user's main function when testing a main package.
+const renamedMainFunc = "igotest_userMain"
+
+// prepareMainPackageTest writes copies of the supplied non-test files of a
+// main package into igo-out, with its main function renamed so that it doesn't
+// clash with the test runner's. It returns the set of files to be compiled into
+// the test runner, including the unmodified test files but not the runner
+// itself.
+func prepareMainPackageTest(packageName string, files *set.StringSet) *set.StringSet {
+	outputDir := path.Join(outDir, "_testmain/"+packageName)
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		panic(err)
+	}
+
+	var result set.StringSet
+	for _, file := range files.Sorted() {
+		if strings.HasSuffix(file, "_test.go") {
+			result.Insert(file)
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+
+		_, baseName := path.Split(file)
+		outputFile := path.Join(outputDir, baseName)
+		writeFile(outputFile, parse.RenameMainFunc(string(contents), renamedMainFunc))
+		result.Insert(outputFile)
+	}
+
+	return &result
+}
+
+// runTests runs the test runners for the supplied packages, which must already
+// have been built, reporting the results according to the flags. Packages with
+// a cached passing result are not run again, unless coverage is being measured.
+// It returns true if and only if all of the packages pass.
+func runTests(packages []string, dirInfos map[string]build.DirectoryInfo) bool {
+	runnerArgs := []string{}
+	allPassed := true
+	var allResults vector.Vector // Of test.TestResult
+
+	for _, packageName := range packages {
+		runnerName := testRunnerName(packageName)
+		testFuncs := dirInfos[packageName].TestFuncs.Sorted()
+
+		resultKey := ""
+		if buildCache != nil && *testCount == 0 && !coverageRequested() {
+			resultKey = testResultKey(runnerName, packageName, runnerArgs)
+			if cachedOutput, ok := lookUpTestResult(resultKey, runnerName); ok {
+				output := newRunnerOutput(packageName, true)
+				output.ProcessString(cachedOutput)
+				output.Finish(testFuncs, &allResults)
+				output.Report(true, true)
+				continue
+			}
+		}
+
+		runs := *testCount
+		if runs == 0 {
+			runs = 1
+		}
+
+		// Run the tests from the package's directory, so that they can find
+		// files in testdata/ and so on.
+		runnerPath := path.Join(projectRoot, outDir+"/"+runnerName)
+		passed := true
+		rawOutput := ""
+		for i := 0; i < runs && passed; i++ {
+			output := newRunnerOutput(packageName, false)
+			step := buildTrace.Start("test", packageName, 0)
+			passed = runTestRunner(runnerPath, runnerArgs, packageName, output)
+			buildTrace.Finish(step)
+			output.Finish(testFuncs, &allResults)
+			if coverageRequested() {
+				collectCoverage(packageName, runnerName)
+			}
+
+			output.Report(passed, false)
+			rawOutput = output.raw.String()
+		}
+
+		if !passed {
+			allPassed = false
+		} else if resultKey != "" {
+			recordTestResult(resultKey, runnerName, rawOutput)
+		}
+	}
+
+	writeJUnitReport(&allResults)
+	return allPassed
+}
+
+// writeJUnitReport writes the supplied results to the file named by the
+// -junit flag, if any.
+func writeJUnitReport(results *vector.Vector) {
+	if *junitFile == "" {
+		return
+	}
+
+	resultSlice := make([]test.TestResult, results.Len())
+	for i := range resultSlice {
+		resultSlice[i] = results.At(i).(test.TestResult)
+	}
+
+	writeFile(userFile(*junitFile), test.FormatJUnit(resultSlice))
+}
+
+// runTestRunner runs the test runner at the supplied path from the supplied
+// directory, feeding its output to the supplied runnerOutput. If the runner
+// runs for longer than the -timeout flag allows, it is sent SIGQUIT so that it
+// dumps its goroutine stacks, and then killed. It returns true if and only if
+// the runner exits successfully.
+func runTestRunner(runnerPath string, args []string, dir string, output *runnerOutput) bool {
+	fmt.Printf("%s %s\n", runnerPath, strings.Join(args, " "))
+
+	var fullArgs vector.StringVector
+	fullArgs.Push(runnerPath)
+	fullArgs.AppendVector(&args)
+
+	// Send the runner's stdout and stderr through a pipe so that we can pick out
+	// the events that it reports.
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	pid, err := os.ForkExec(
+		runnerPath,
+		fullArgs.Data(),
+		os.Environ(),
+		dir,
+		[]*os.File{os.Stdin, writer, writer})
+	if err != nil {
+		panic(err)
+	}
+
+	writer.Close()
+
+	outputDone := make(chan bool)
+	go func() {
+		output.Process(reader)
+		reader.Close()
+		outputDone <- true
+	}()
+
+	exited := make(chan *os.Waitmsg)
+	go func() {
+		waitMsg, err := os.Wait(pid, 0)
+		if err != nil {
+			panic(err)
+		}
+
+		exited <- waitMsg
+	}()
+
+	var waitMsg *os.Waitmsg
+	select {
+	case waitMsg = <-exited:
+	case <-afterSeconds(*testTimeout):
+		fmt.Printf(
+			"\nTest runner timed out after %d seconds. Goroutine stacks follow.\n",
+			*testTimeout)
+		syscall.Kill(pid, syscall.SIGQUIT)
+
+		select {
+		case waitMsg = <-exited:
+		case <-after(stackDumpGracePeriod):
+			syscall.Kill(pid, syscall.SIGKILL)
+			waitMsg = <-exited
+		}
+	}
+
+	<-outputDone
+
+	if running := output.collector.Running(); running != "" {
+		fmt.Printf("\nTest still running when the runner exited: %s\n", running)
+	}
+
+	return waitMsg.ExitStatus() == 0
+}
+
+// afterSeconds returns a channel that receives a value after the supplied
+// number of seconds, or never if it is zero.
+func afterSeconds(seconds int) <-chan bool {
+	if seconds <= 0 {
+		return make(chan bool)
+	}
+
+	return after(int64(seconds) * 1e9)
+}
+
+// after returns a channel that receives a value after the supplied number of
+// nanoseconds. The channel is buffered so that the sleeping goroutine can exit
+// even if nobody receives from it.
+func after(ns int64) <-chan bool {
+	result := make(chan bool, 1)
+	go func() {
+		time.Sleep(ns)
+		result <- true
+	}()
+
+	return result
+}
+
+// runnerOutput interprets the output of a single run of a test runner, either
+// live or replayed from the cache, and reports it in the form requested by
+// the flags.
+type runnerOutput struct {
+	collector test.ResultCollector
+	results   []test.TestResult
+
+	// Everything the runner printed, including events.
+	raw bytes.Buffer
+
+	// Whether to hold back the runner's output and per-test timings, as when
+	// replaying a cached result.
+	quiet bool
+}
+
+func newRunnerOutput(packageName string, quiet bool) *runnerOutput {
+	o := &runnerOutput{quiet: quiet}
+	o.collector.Package = packageName
+	o.collector.OnEvent = func(action string, result *test.TestResult) {
+		o.onEvent(action, result)
+	}
+
+	return o
+}
+
+func (o *runnerOutput) onEvent(action string, result *test.TestResult) {
+	if *jsonOutput {
+		fmt.Fprintln(jsonOut, test.FormatJSONEvent(action, result))
+		return
+	}
+
+	if !o.quiet && (action == "pass" || action == "fail") {
+		fmt.Printf("--- %s (%s)\n", result.Name, formatDuration(result.Elapsed))
+	}
+}
+
+// Process reads and interprets output from r until it is exhausted.
+func (o *runnerOutput) Process(r io.Reader) {
+	bufReader := bufio.NewReader(r)
+	for {
+		line, err := bufReader.ReadString('\n')
+		if line != "" {
+			o.addLine(line)
+		}
+
+		if err != nil {
+			break
+		}
+	}
+}
+
+// ProcessString interprets the supplied output.
+func (o *runnerOutput) ProcessString(s string) {
+	for s != "" {
+		end := strings.Index(s, "\n") + 1
+		if end == 0 {
+			end = len(s)
+		}
+
+		o.addLine(s[0:end])
+		s = s[end:]
+	}
+}
+
+func (o *runnerOutput) addLine(line string) {
+	o.raw.WriteString(line)
+	output := o.collector.AddLine(line)
+	if output != "" && !o.quiet && !*jsonOutput {
+		fmt.Print(output)
+	}
+}
+
+// Finish is called once the runner's output is exhausted, with the names of
+// the package's test functions. It adds the results of the tests to results.
+func (o *runnerOutput) Finish(testFuncs []string, results *vector.Vector) {
+	o.results = o.collector.Finish(testFuncs)
+	for _, result := range o.results {
+		results.Push(result)
+	}
+}
+
+// Report prints the overall result for the package, and a list of its slowest
+// tests.
+func (o *runnerOutput) Report(passed bool, cached bool) {
+	status := "ok"
+	if !passed {
+		status = "FAIL"
+	}
+
+	note := ""
+	if cached {
+		note = " (cached)"
+	}
+
+	if *jsonOutput {
+		action := "pass"
+		if !passed {
+			action = "fail"
+		}
+
+		fmt.Fprintln(
+			jsonOut,
+			test.FormatJSONPackageEvent(action, o.collector.Package, o.collector.Output+note))
+	}
+
+	fmt.Printf("%s  %s%s\n", status, o.collector.Package, note)
+	if !cached {
+		o.printSlowest(*slowestTests)
+	}
+}
+
+// printSlowest prints up to n of the slowest tests that ran.
+func (o *runnerOutput) printSlowest(n int) {
+	var timings vector.Vector
+	for _, result := range o.results {
+		if result.Status != "skip" {
+			timings.Push(test.TestTiming{result.Name, result.Elapsed})
+		}
+	}
+
+	if n <= 0 || timings.Len() == 0 {
+		return
+	}
+
+	timingSlice := make([]test.TestTiming, timings.Len())
+	for i := range timingSlice {
+		timingSlice[i] = timings.At(i).(test.TestTiming)
+	}
+
+	fmt.Println("Slowest tests:")
+	for _, timing := range test.SlowestTests(timingSlice, n) {
+		fmt.Printf("  %s  %s\n", formatDuration(timing.Elapsed), timing.Name)
+	}
+}
+
+// formatDuration formats a duration in nanoseconds as seconds.
+func formatDuration(ns int64) string {
+	return fmt.Sprintf("%.3f seconds", float64(ns)/1e9)
+}
+
+func writeFile(name string, contents string) {
+	err := ioutil.WriteFile(name, strings.Bytes(contents), 0600)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"flag"
+	"igo/build"
+	"igo/set"
+	"io/ioutil"
+	"strings"
+)
+
+var scanJobs = flag.Int(
+	"scanjobs",
+	0,
+	"Number of directories to scan for source files or packages at once. "+
+		"Defaults to the number of CPUs.")
+
+// The result of scanning a single package directory.
+type scanResult struct {
+	packageName string
+	dirInfo     build.DirectoryInfo
+}
+
+// scanPackages returns the DirectoryInfo of each of the supplied packages and
+// of every local package that they depend upon, scanning up to -scanjobs
+// directories at once. The dependencies of the packages in testedPackages
+// include those of their tests.
+//
+// Packages are scanned in no particular order, so callers must not depend on
+// the order of iteration over the result.
+func scanPackages(packages []string, testedPackages *set.StringSet) map[string]build.DirectoryInfo {
+	jobs := scanJobCount()
+
+	// A slot must be taken before scanning a directory, and returned
+	// afterward. The slots are numbered for the trace, from one so as not to
+	// clash with the main thread.
+	slots := make(chan int, jobs)
+	for i := 1; i <= jobs; i++ {
+		slots <- i
+	}
+
+	results := make(chan scanResult)
+
+	var requested set.StringSet
+	outstanding := 0
+
+	request := func(packageName string) {
+		if requested.Contains(packageName) {
+			return
+		}
+
+		requested.Insert(packageName)
+		outstanding++
+
+		go func() {
+			slot := <-slots
+			step := buildTrace.Start("scan", packageName, slot)
+			dirInfo := importConfig.GetDirectoryInfo("./" + packageName)
+			buildTrace.Finish(step)
+			slots <- slot
+
+			results <- scanResult{packageName, dirInfo}
+		}()
+	}
+
+	for _, packageName := range packages {
+		request(packageName)
+	}
+
+	dirInfos := make(map[string]build.DirectoryInfo)
+	for outstanding > 0 {
+		result := <-results
+		outstanding--
+
+		dirInfos[result.packageName] = result.dirInfo
+
+		for dep := range result.dirInfo.Deps.Iter() {
+			request(dep)
+		}
+
+		if testedPackages.Contains(result.packageName) {
+			for dep := range result.dirInfo.TestDeps.Iter() {
+				request(dep)
+			}
+		}
+	}
+
+	return dirInfos
+}
+
+// scanJobCount returns the number of directories to scan or read at once,
+// according to -scanjobs.
+func scanJobCount() int {
+	if *scanJobs > 0 {
+		return *scanJobs
+	}
+
+	return numCPU()
+}
+
+// numCPU returns the number of CPUs listed in /proc/cpuinfo, or one if it
+// can't be read.
+func numCPU() int {
+	contents, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return 1
+	}
+
+	count := 0
+	for s := string(contents); s != ""; {
+		if strings.HasPrefix(s, "processor") {
+			count++
+		}
+
+		end := strings.Index(s, "\n")
+		if end < 0 {
+			break
+		}
+
+		s = s[end+1:]
+	}
+
+	if count == 0 {
+		return 1
+	}
+
+	return count
+}
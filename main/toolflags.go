@@ -0,0 +1,245 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"bytes"
+	"container/vector"
+	"flag"
+	"fmt"
+	"igo/build"
+	"igo/set"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A flag such as -gcflags that may be given more than once. Its values are
+// kept in the order given.
+type repeatedFlag struct {
+	values vector.StringVector
+}
+
+func (f *repeatedFlag) String() string { return strings.Join(f.values.Data(), " ") }
+
+func (f *repeatedFlag) Set(value string) bool {
+	f.values.Push(value)
+	return true
+}
+
+// newRepeatedFlag defines a flag with the supplied name and usage that may be
+// given more than once.
+func newRepeatedFlag(name string, usage string) *repeatedFlag {
+	result := new(repeatedFlag)
+	flag.Var(result, name, usage)
+	return result
+}
+
+var gcFlags = newRepeatedFlag(
+	"gcflags",
+	"Extra arguments to pass to the compiler. By default they apply to the "+
+		"packages named on the command line; use pattern=args (e.g. "+
+		"foo/...=-N) to choose the packages instead. May be repeated, in which "+
+		"case the last value matching a package applies to it.")
+
+var ldFlags = newRepeatedFlag(
+	"ldflags",
+	"Extra arguments to pass to the linker, in the same form as -gcflags.")
+
+var stampVar = flag.String(
+	"stampvar",
+	"",
+	"Name of a string variable in the main packages being built to set to "+
+		"the git revision and commit time of the project.")
+
+var stampTime = flag.String(
+	"stamptime",
+	"",
+	"Time to record with -stampvar in place of the commit time, such as the "+
+		"time of a release.")
+
+// The parsed form of a flag such as -gcflags: for each value given, the
+// arguments and the packages they apply to.
+type toolFlags []toolFlagsEntry
+
+type toolFlagsEntry struct {
+	packages set.StringSet
+	args     []string
+}
+
+var compilerFlags toolFlags
+var linkerFlags toolFlags
+
+// initToolFlags parses the -gcflags and -ldflags flags, exiting the program if
+// they are malformed. Values without a pattern apply to the supplied packages.
+func initToolFlags(specifiedPackages []string) {
+	compilerFlags = parseToolFlags("gcflags", gcFlags.values.Data(), specifiedPackages)
+	linkerFlags = parseToolFlags("ldflags", ldFlags.values.Data(), specifiedPackages)
+}
+
+func parseToolFlags(name string, values []string, specifiedPackages []string) toolFlags {
+	result := make(toolFlags, len(values))
+	for i, value := range values {
+		pattern, args, err := build.ParseToolFlags(value)
+		if err != nil {
+			fmt.Printf("Invalid -%s: %s\n", name, err)
+			os.Exit(1)
+		}
+
+		packages := specifiedPackages
+		if pattern != "" {
+			packages = resolvePackageArgs([]string{pattern})
+		}
+
+		result[i].args = args
+		for _, packageName := range packages {
+			result[i].packages.Insert(packageName)
+		}
+	}
+
+	return result
+}
+
+// argsFor returns the extra arguments to be passed to the tool when building
+// the supplied target: those of the last value of the flag that applies to it.
+func (f toolFlags) argsFor(targetBaseName string) []string {
+	for i := len(f) - 1; i >= 0; i-- {
+		if f[i].packages.Contains(targetBaseName) {
+			return f[i].args
+		}
+	}
+
+	return []string{}
+}
+
+// writeStampFile writes a file for the supplied main package that sets the
+// variable named by the -stampvar flag to the project's git revision and either
+// the time given by -stamptime or the commit time of the revision, returning
+// the name of the file. The current time isn't used, so that building the same
+// revision twice gives the same result.
+func writeStampFile(packageName string) string {
+	varName := *stampVar
+	if strings.HasPrefix(varName, "main.") {
+		varName = varName[len("main."):]
+	}
+
+	stampedTime := *stampTime
+	if stampedTime == "" {
+		stampedTime = gitCommitTime()
+	}
+
+	stamp := fmt.Sprintf("%s %s", gitRevision(), stampedTime)
+
+	outputDir := path.Join(outDir, "_stamp/"+packageName)
+	if err := os.MkdirAll(outputDir, 0700); err != nil {
+		panic(err)
+	}
+
+	file := path.Join(outputDir, "igo_stamp.go")
+	writeFile(
+		file,
+		fmt.Sprintf(stampTemplate, varName, strconv.Quote(stamp)))
+
+	return file
+}
+
+const stampTemplate = `package main
+
+func init() {
+	%s = %s
+}
+`
+
+// gitRevision returns the revision of the git repository containing the project
+// root, or "unknown" if it can't be determined.
+func gitRevision() string {
+	return gitOutput([]string{"rev-parse", "HEAD"})
+}
+
+// gitCommitTime returns the commit time of the revision returned by
+// gitRevision, or "unknown" if it can't be determined.
+func gitCommitTime() string {
+	return gitOutput([]string{"show", "-s", "--format=%ci", "HEAD"})
+}
+
+// gitOutput runs git with the supplied arguments in the project root and
+// returns its output, minus surrounding whitespace, or "unknown" if it can't be
+// run or fails.
+func gitOutput(args []string) string {
+	gitPath := findExecutable("git")
+	if gitPath == "" {
+		return "unknown"
+	}
+
+	output, ok := captureCommand(gitPath, args, projectRoot)
+	if !ok {
+		return "unknown"
+	}
+
+	return strings.TrimSpace(output)
+}
+
+// captureCommand runs the program at the supplied path with the supplied
+// arguments from the supplied directory, and returns its standard output. ok
+// is false if the program can't be run or fails.
+func captureCommand(programPath string, args []string, dir string) (output string, ok bool) {
+	var fullArgs vector.StringVector
+	fullArgs.Push(programPath)
+	fullArgs.AppendVector(&args)
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	pid, err := os.ForkExec(
+		programPath,
+		fullArgs.Data(),
+		os.Environ(),
+		dir,
+		[]*os.File{os.Stdin, writer, os.Stderr})
+	writer.Close()
+	if err != nil {
+		reader.Close()
+		return "", false
+	}
+
+	var buf bytes.Buffer
+	io.Copy(&buf, reader)
+	reader.Close()
+
+	waitMsg, err := os.Wait(pid, 0)
+	if err != nil {
+		panic(err)
+	}
+
+	return buf.String(), waitMsg.ExitStatus() == 0
+}
+
+// findExecutable returns the path of the named program within the directories
+// listed in $PATH, or the empty string if there is none.
+func findExecutable(name string) string {
+	dirs := os.Getenv("PATH")
+	for dirs != "" {
+		end := strings.Index(dirs, ":")
+		if end < 0 {
+			end = len(dirs)
+		}
+
+		candidate := path.Join(dirs[0:end], name)
+		if d, err := os.Stat(candidate); err == nil && d.IsRegular() {
+			return candidate
+		}
+
+		if end == len(dirs) {
+			break
+		}
+
+		dirs = dirs[end+1:]
+	}
+
+	return ""
+}
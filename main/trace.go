@@ -0,0 +1,106 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"container/vector"
+	"flag"
+	"fmt"
+	"igo/set"
+	"igo/trace"
+	"strings"
+	"time"
+)
+
+var traceFile = flag.String(
+	"trace",
+	"",
+	"Write a trace of the build's steps to this file, in the trace event "+
+		"format read by Chrome's trace viewer (about:tracing).")
+
+// The steps of this run of igo, and when it started.
+var buildTrace trace.Recorder
+var buildStartTime = time.Nanoseconds()
+
+// The kinds of step that make up building a package, as opposed to scanning
+// its directory or running its tests.
+var buildStepKinds = map[string]bool{
+	"cgo":      true,
+	"compile":  true,
+	"assemble": true,
+	"pack":     true,
+	"restore":  true,
+	"link":     true,
+}
+
+// executeStep runs the supplied tool as executeCommand does, recording it as a
+// step of the supplied kind for the supplied target.
+func executeStep(kind string, target string, tool string, args []string, dir string) bool {
+	step := buildTrace.Start(kind, target, 0)
+	ok := executeCommand(tool, args, dir)
+	buildTrace.Finish(step)
+
+	return ok
+}
+
+// reportTiming prints the time spent on each target, and the critical path
+// through the packages in totalOrder: the chain of dependencies whose build
+// steps took the longest in total. It then writes the trace requested by the
+// -trace flag, if any.
+func reportTiming(totalOrder []string, packageDeps map[string]*set.StringSet) {
+	steps := buildTrace.Steps()
+	durations := trace.Durations(steps)
+
+	var targets set.StringSet
+	for target, _ := range durations {
+		targets.Insert(target)
+	}
+
+	fmt.Println("\nTiming:")
+	for _, target := range targets.Sorted() {
+		var kinds set.StringSet
+		total := int64(0)
+		for kind, duration := range durations[target] {
+			kinds.Insert(kind)
+			total += duration
+		}
+
+		var breakdown vector.StringVector
+		for _, kind := range kinds.Sorted() {
+			breakdown.Push(fmt.Sprintf("%s %s", kind, formatStepTime(durations[target][kind])))
+		}
+
+		fmt.Printf(
+			"  %8s  %s (%s)\n",
+			formatStepTime(total),
+			target,
+			strings.Join(breakdown.Data(), ", "))
+	}
+
+	buildTimes := make(map[string]int64)
+	for target, byKind := range durations {
+		for kind, duration := range byKind {
+			if buildStepKinds[kind] {
+				buildTimes[target] += duration
+			}
+		}
+	}
+
+	path, total := trace.CriticalPath(buildTimes, totalOrder, packageDeps)
+	fmt.Printf("\nCritical path: %s\n", formatStepTime(total))
+	for _, packageName := range path {
+		fmt.Printf("  %8s  %s\n", formatStepTime(buildTimes[packageName]), packageName)
+	}
+
+	if *traceFile != "" {
+		writeFile(userFile(*traceFile), trace.FormatChromeTrace(steps, buildStartTime))
+	}
+}
+
+// formatStepTime formats the supplied number of nanoseconds as seconds, more
+// tersely than formatDuration so that the timing report's columns line up. The
+// result is no wider than eight characters for steps of under three hours.
+func formatStepTime(ns int64) string {
+	return fmt.Sprintf("%.2fs", float64(ns)/1e9)
+}
@@ -0,0 +1,93 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package main
+
+import (
+	"fmt"
+	"igo/build"
+	"igo/cache"
+	"os"
+	"path"
+	"strings"
+)
+
+// vendorPackages copies the source trees of the packages with the supplied
+// import paths from $GOPATH into the vendor directory at the project root,
+// replacing any existing copies. It exits the program if a package can't be
+// found or copied.
+func vendorPackages(importPaths []string) {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		fmt.Println("Please set $GOPATH to find the packages to vendor in.")
+		os.Exit(1)
+	}
+
+	for _, importPath := range importPaths {
+		src := findInGopath(gopath, importPath)
+		if src == "" {
+			fmt.Printf("Couldn't find %s in $GOPATH.\n", importPath)
+			os.Exit(1)
+		}
+
+		dst := path.Join(build.VendorDir, importPath)
+		fmt.Printf("Copying %s to %s\n", src, userPath(dst))
+
+		if err := os.RemoveAll(dst); err != nil {
+			fmt.Printf("Couldn't remove %s: %s\n", userPath(dst), err)
+			os.Exit(1)
+		}
+
+		visitor := vendorVisitor{src: src, dst: dst}
+		path.Walk(src, &visitor, nil)
+		if visitor.err != nil {
+			fmt.Printf("Couldn't copy %s: %s\n", importPath, visitor.err)
+			os.Exit(1)
+		}
+	}
+}
+
+// findInGopath returns the source directory of the package with the supplied
+// import path in the first of the colon-separated directories in gopath that
+// contains it, or the empty string if there is none.
+func findInGopath(gopath string, importPath string) string {
+	for gopath != "" {
+		end := strings.Index(gopath, ":")
+		if end < 0 {
+			end = len(gopath)
+		}
+
+		dir := path.Join(gopath[0:end], "src/"+importPath)
+		if d, err := os.Stat(dir); err == nil && d.IsDirectory() {
+			return dir
+		}
+
+		if end == len(gopath) {
+			break
+		}
+
+		gopath = gopath[end+1:]
+	}
+
+	return ""
+}
+
+// vendorVisitor copies the files beneath src to the same places beneath dst,
+// skipping hidden directories such as .git.
+type vendorVisitor struct {
+	src string
+	dst string
+	err os.Error
+}
+
+func (v *vendorVisitor) VisitDir(dir string, d *os.Dir) bool {
+	return dir == v.src || !strings.HasPrefix(d.Name, ".")
+}
+
+func (v *vendorVisitor) VisitFile(file string, d *os.Dir) {
+	if v.err != nil {
+		return
+	}
+
+	v.err = cache.CopyFile(file, path.Join(v.dst, file[len(v.src)+1:]))
+}
@@ -0,0 +1,117 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package parse
+
+import (
+	"bytes"
+	"gob"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// A FileCache memoises the FileInfo of .go files by path. A file is parsed
+// again only if its modification time or size has changed since it was last
+// parsed. A nil *FileCache is valid, and parses every file afresh. A FileCache
+// may be used by multiple goroutines at once.
+type FileCache struct {
+	mutex   sync.Mutex
+	entries map[string]fileCacheEntry
+}
+
+// The fields are exported so that entries can be persisted with gob.
+type fileCacheEntry struct {
+	File  string
+	Mtime uint64
+	Size  uint64
+	Info  FileInfo
+}
+
+// NewFileCache returns an empty cache.
+func NewFileCache() *FileCache {
+	return &FileCache{entries: make(map[string]fileCacheEntry)}
+}
+
+// GetFileInfo returns the FileInfo for the named file, reading and parsing it
+// only if necessary.
+func (c *FileCache) GetFileInfo(file string) (info FileInfo, err os.Error) {
+	d, err := os.Stat(file)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	if c != nil {
+		c.mutex.Lock()
+		entry, ok := c.entries[file]
+		c.mutex.Unlock()
+
+		if ok && entry.Mtime == d.Mtime_ns && entry.Size == d.Size {
+			return entry.Info, nil
+		}
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info = GetFileInfo(file, string(contents))
+	if c != nil {
+		c.mutex.Lock()
+		c.entries[file] = fileCacheEntry{file, d.Mtime_ns, d.Size, info}
+		c.mutex.Unlock()
+	}
+
+	return info, nil
+}
+
+// LoadFileCache reads a cache written by Save. If the file doesn't exist or
+// can't be decoded, an empty cache is returned.
+func LoadFileCache(file string) *FileCache {
+	result := NewFileCache()
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return result
+	}
+
+	var entries []fileCacheEntry
+	if err := gob.NewDecoder(bytes.NewBuffer(contents)).Decode(&entries); err != nil {
+		return result
+	}
+
+	for _, entry := range entries {
+		result.entries[entry.File] = entry
+	}
+
+	return result
+}
+
+// Save writes the contents of the cache to the supplied file, creating its
+// directory if necessary.
+func (c *FileCache) Save(file string) os.Error {
+	c.mutex.Lock()
+	entries := make([]fileCacheEntry, len(c.entries))
+	i := 0
+	for _, entry := range c.entries {
+		entries[i] = entry
+		i++
+	}
+	c.mutex.Unlock()
+
+	dir, _ := path.Split(file)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entries); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, buf.Bytes(), 0600)
+}
@@ -0,0 +1,123 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package parse
+
+import (
+	"fmt"
+	"io/ioutil"
+	"once"
+	"os"
+	"path"
+	"rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedRand() { rand.Seed(time.Nanoseconds()) }
+
+func createTempDir() string {
+	once.Do(seedRand)
+	result := fmt.Sprintf("/tmp/cache_test.%d", rand.Uint32())
+	if err := os.Mkdir(result, 0700); err != nil {
+		panic(fmt.Sprintf("Can't create dir [%s]: %s", result, err))
+	}
+
+	return result
+}
+
+func writeSource(file string, source string) {
+	if err := ioutil.WriteFile(file, strings.Bytes(source), 0600); err != nil {
+		panic(fmt.Sprintf("Can't write file [%s]: %s", file, err))
+	}
+}
+
+func expectPackageName(t *testing.T, c *FileCache, file string, expected string) {
+	info, err := c.GetFileInfo(file)
+	if err != nil {
+		t.Fatalf("GetFileInfo(%s): %s", file, err)
+	}
+
+	if info.PackageName != expected {
+		t.Errorf("Expected package %s, got: %s", expected, info.PackageName)
+	}
+}
+
+func TestFileCacheMissingFile(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	if _, err := NewFileCache().GetFileInfo(path.Join(dir, "foo.go")); err == nil {
+		t.Errorf("Expected an error for a missing file.")
+	}
+}
+
+func TestFileCacheReparsesChangedFiles(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "foo.go")
+	writeSource(file, "package foo\n")
+
+	cache := NewFileCache()
+	expectPackageName(t, cache, file, "foo")
+
+	// A file of a different size is parsed again.
+	writeSource(file, "package foobar\n")
+	expectPackageName(t, cache, file, "foobar")
+
+	// An unchanged file is not.
+	cache.entries[file] = fileCacheEntry{
+		file,
+		cache.entries[file].Mtime,
+		cache.entries[file].Size,
+		FileInfo{PackageName: "memoised"},
+	}
+
+	expectPackageName(t, cache, file, "memoised")
+}
+
+func TestFileCacheNil(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "foo.go")
+	writeSource(file, "package foo\n")
+
+	var cache *FileCache
+	expectPackageName(t, cache, file, "foo")
+}
+
+func TestFileCacheSaveAndLoad(t *testing.T) {
+	dir := createTempDir()
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "foo.go")
+	writeSource(file, "package foo\n\nimport \"fmt\"\n")
+
+	cache := NewFileCache()
+	expectPackageName(t, cache, file, "foo")
+
+	cacheFile := path.Join(dir, "cache/files.gob")
+	if err := cache.Save(cacheFile); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+
+	loaded := LoadFileCache(cacheFile)
+	entry, ok := loaded.entries[file]
+	if !ok {
+		t.Fatalf("Expected an entry for %s, got: %v", file, loaded.entries)
+	}
+
+	if entry.Info.PackageName != "foo" || len(entry.Info.Imports) != 1 {
+		t.Errorf("Unexpected entry: %v", entry)
+	}
+}
+
+func TestLoadFileCacheMissingFile(t *testing.T) {
+	cache := LoadFileCache("/tmp/does/not/exist.gob")
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected an empty cache, got: %v", cache.entries)
+	}
+}
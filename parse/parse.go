@@ -6,22 +6,18 @@
 package parse
 
 import (
+	"container/vector"
 	"go/ast"
 	"go/parser"
 	"igo/set"
-	"regexp"
+	"strconv"
 	"strings"
 )
 
 // GetPackageName returns the package name from the supplied .go file source
 // code, or the empty string if it could not be properly parsed.
 func GetPackageName(source string) string {
-	fileNode, err := parser.ParseFile("", source, nil, parser.ImportsOnly)
-	if err != nil {
-		return ""
-	}
-
-	return fileNode.Name.Name()
+	return GetFileInfo("", source).PackageName
 }
 
 // GetImports parses the supplied source code for a .go file and returns a set
@@ -44,35 +40,99 @@ func GetPackageName(source string) string {
 // An attempt is made to return the imports for the file even if there is a
 // syntax error elsewhere in the file.
 func GetImports(source string) *set.StringSet {
+	result := &set.StringSet{}
+	for _, record := range GetImportRecords("", source) {
+		result.Insert(record.Path)
+	}
+
+	return result
+}
+
+// An Import records a single import spec within a .go file.
+type Import struct {
+	Path string // The imported path, such as "fmt".
+
+	// The local name given to the package, if any: an alias, "." or "_". It is
+	// empty if the package is imported under its own name.
+	Name string
+
+	// The position of the import path within the file.
+	File   string
+	Line   int
+	Column int
+
+	InTest bool // Whether File is a test file.
+}
+
+// GetImportRecords parses the supplied source code for the named .go file and
+// returns a record of each import it contains, in source order. Imports with
+// malformed paths are skipped. Like GetImports, it makes an attempt to return
+// the imports even if there is a syntax error elsewhere in the file.
+//
+// For example, if source looks like the following:
+//
+//     import (
+//       "fmt"
+//       . "./bar/baz"
+//     )
+//
+// then the result will contain a record with Path "fmt" on line 2, followed by
+// one with Path "./bar/baz" and Name "." on line 3.
+func GetImportRecords(file string, source string) []Import {
 	node, err := parser.ParseFile("", source, nil, parser.ImportsOnly)
 	if err != nil {
-		return &set.StringSet{}
+		return []Import{}
 	}
 
+	return getImportRecords(file, node)
+}
+
+func getImportRecords(file string, node *ast.File) []Import {
 	var visitor importVisitor
+	visitor.file = file
+	visitor.inTest = strings.HasSuffix(file, "_test.go")
 	ast.Walk(&visitor, node)
 
-	return &visitor.imports
+	result := make([]Import, visitor.imports.Len())
+	for i := range result {
+		result[i] = visitor.imports.At(i).(Import)
+	}
+
+	return result
 }
 
 type importVisitor struct {
-	imports set.StringSet
+	file    string
+	inTest  bool
+	imports vector.Vector // Of Import
 }
 
-var importRegexp *regexp.Regexp = regexp.MustCompile(`"(.+)"`)
-
 func (v *importVisitor) Visit(node interface{}) ast.Visitor {
-	switch t := node.(type) {
-	case *ast.ImportSpec:
-		component := node.(*ast.ImportSpec).Path
-		matches := importRegexp.MatchStrings(string(component.Value))
-		if len(matches) < 2 {
-			// skipping this?
-		} else {
-			v.imports.Insert(matches[1])
-		}
+	spec, ok := node.(*ast.ImportSpec)
+	if !ok {
+		return v
 	}
 
+	importPath, err := strconv.Unquote(string(spec.Path.Value))
+	if err != nil || importPath == "" {
+		return v
+	}
+
+	name := ""
+	if spec.Name != nil {
+		name = spec.Name.Name()
+	}
+
+	position := spec.Path.Pos()
+	v.imports.Push(Import{
+		importPath,
+		name,
+		v.file,
+		position.Line,
+		position.Column,
+		v.inTest,
+	})
+
 	return v
 }
 
@@ -93,28 +153,172 @@ func (v *importVisitor) Visit(node interface{}) ast.Visitor {
 //
 // then the result will be { "TestBlah", "TestAsdf" }.
 func GetTestFunctions(source string) *set.StringSet {
+	result := &set.StringSet{}
+	for _, name := range GetFileInfo("", source).TestFuncs {
+		result.Insert(name)
+	}
+
+	return result
+}
+
+// A FileInfo holds everything igo needs to know about a .go file, gathered
+// from a single parse.
+type FileInfo struct {
+	PackageName string
+	Imports     []Import
+
+	// The names of top-level functions beginning with "Test", "Benchmark", and
+	// "Example", in source order.
+	TestFuncs      []string
+	BenchmarkFuncs []string
+	ExampleFuncs   []string
+
+	// The arguments of the "// +build" comments preceding the package clause,
+	// such as "linux darwin".
+	BuildConstraints []string
+}
+
+// GetFileInfo parses the supplied source code for the named .go file. If the
+// file contains a syntax error, an attempt is made to return its package name
+// and imports anyway; see GetImports.
+func GetFileInfo(file string, source string) FileInfo {
+	info := FileInfo{BuildConstraints: getBuildConstraints(source)}
+
 	node, err := parser.ParseFile("", source, nil, 0)
 	if err != nil {
-		return &set.StringSet{}
+		node, err = parser.ParseFile("", source, nil, parser.ImportsOnly)
+		if err != nil {
+			info.Imports = []Import{}
+			return info
+		}
 	}
 
-	var visitor testFunctionVisitor
-	ast.Walk(&visitor, node)
+	info.PackageName = node.Name.Name()
+	info.Imports = getImportRecords(file, node)
+
+	var testFuncs, benchmarkFuncs, exampleFuncs vector.StringVector
+	for _, decl := range node.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Recv != nil {
+			continue
+		}
+
+		name := funcDecl.Name.Name()
+		switch {
+		case strings.HasPrefix(name, "Test"):
+			testFuncs.Push(name)
+		case strings.HasPrefix(name, "Benchmark"):
+			benchmarkFuncs.Push(name)
+		case strings.HasPrefix(name, "Example"):
+			exampleFuncs.Push(name)
+		}
+	}
+
+	info.TestFuncs = testFuncs.Data()
+	info.BenchmarkFuncs = benchmarkFuncs.Data()
+	info.ExampleFuncs = exampleFuncs.Data()
+
+	return info
+}
+
+// getBuildConstraints returns the arguments of the "// +build" lines within the
+// comments at the start of the supplied source.
+func getBuildConstraints(source string) []string {
+	var result vector.StringVector
+	for source != "" {
+		end := strings.Index(source, "\n")
+		if end < 0 {
+			end = len(source)
+		}
+
+		line := strings.TrimSpace(source[0:end])
+		if line != "" && !strings.HasPrefix(line, "//") {
+			break
+		}
+
+		if strings.HasPrefix(line, "//") {
+			comment := strings.TrimSpace(line[len("//"):])
+			if strings.HasPrefix(comment, "+build ") {
+				result.Push(strings.TrimSpace(comment[len("+build "):]))
+			}
+		}
 
-	return &visitor.testFunctions
+		if end == len(source) {
+			break
+		}
+
+		source = source[end+1:]
+	}
+
+	return result.Data()
 }
 
-type testFunctionVisitor struct {
-	testFunctions set.StringSet
+// RenameMainFunc returns a copy of the supplied source code for a .go file in
+// which the top-level function main, if any, has been renamed to newName.
+// This allows the file to be compiled alongside a different main function,
+// such as a test runner's. The source is returned unchanged if it can't be
+// parsed.
+func RenameMainFunc(source string, newName string) string {
+	fileNode, err := parser.ParseFile("", source, nil, 0)
+	if err != nil {
+		return source
+	}
+
+	for _, decl := range fileNode.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || funcDecl.Recv != nil || funcDecl.Name.Name() != "main" {
+			continue
+		}
+
+		offset := funcDecl.Name.Pos().Offset
+		return source[0:offset] + newName + source[offset+len("main"):]
+	}
+
+	return source
 }
 
-func (v *testFunctionVisitor) Visit(node interface{}) ast.Visitor {
-	switch t := node.(type) {
-	case *ast.FuncDecl:
-		name := node.(*ast.FuncDecl).Name.Obj.Name
-		if strings.HasPrefix(name, "Test") {
-			v.testFunctions.Insert(name)
+// RewriteImports returns a copy of the supplied source code for a .go file in
+// which each import path that is a key of paths has been replaced by the
+// corresponding value. Nothing else changes, so positions in the rest of the
+// file stay the same. The source is returned unchanged if its imports can't be
+// parsed.
+func RewriteImports(source string, paths map[string]string) string {
+	fileNode, err := parser.ParseFile("", source, nil, parser.ImportsOnly)
+	if err != nil {
+		return source
+	}
+
+	var visitor importSpecVisitor
+	ast.Walk(&visitor, fileNode)
+
+	// Work backwards, so that the offsets of earlier imports are unaffected.
+	for i := visitor.specs.Len() - 1; i >= 0; i-- {
+		spec := visitor.specs.At(i).(*ast.ImportSpec)
+		importPath, err := strconv.Unquote(string(spec.Path.Value))
+		if err != nil {
+			continue
+		}
+
+		newPath, ok := paths[importPath]
+		if !ok {
+			continue
 		}
+
+		offset := spec.Path.Pos().Offset
+		end := offset + len(spec.Path.Value)
+		source = source[0:offset] + strconv.Quote(newPath) + source[end:]
+	}
+
+	return source
+}
+
+type importSpecVisitor struct {
+	specs vector.Vector // Of *ast.ImportSpec
+}
+
+func (v *importSpecVisitor) Visit(node interface{}) ast.Visitor {
+	if spec, ok := node.(*ast.ImportSpec); ok {
+		v.specs.Push(spec)
 	}
 
 	return v
@@ -180,6 +180,52 @@ func TestGetImportsSyntaxErrorAfterImports(t *testing.T) {
 // GetTestFunctions
 ////////////////////////////////
 
+func TestGetImportRecordsEmptyFile(t *testing.T) {
+	records := GetImportRecords("foo.go", "")
+	if len(records) != 0 {
+		t.Errorf("Expected no imports, got: %v", records)
+	}
+}
+
+func TestGetImportRecords(t *testing.T) {
+	code := `package asdf
+
+import "./foo/bar"
+import (
+	"fmt"
+
+	b "./baz"
+	. "os"
+	_ "http"
+)
+
+func DoSomething() {
+}
+`
+	expected := []Import{
+		Import{"./foo/bar", "", "foo.go", 3, 8, false},
+		Import{"fmt", "", "foo.go", 5, 2, false},
+		Import{"./baz", "b", "foo.go", 7, 4, false},
+		Import{"os", ".", "foo.go", 8, 4, false},
+		Import{"http", "_", "foo.go", 9, 4, false},
+	}
+
+	records := GetImportRecords("foo.go", code)
+	if !reflect.DeepEqual(expected, records) {
+		t.Errorf("Expected: %v\nGot: %v", expected, records)
+	}
+}
+
+func TestGetImportRecordsTestFile(t *testing.T) {
+	code := "package asdf\n\nimport \"testing\"\n"
+	expected := []Import{Import{"testing", "", "dir/foo_test.go", 3, 8, true}}
+
+	records := GetImportRecords("dir/foo_test.go", code)
+	if !reflect.DeepEqual(expected, records) {
+		t.Errorf("Expected: %v\nGot: %v", expected, records)
+	}
+}
+
 func TestGetTestFunctionsEmptyFile(t *testing.T) {
 	code := ""
 	expected := []string{}
@@ -246,3 +292,201 @@ func TestGetTestFunctionsSyntaxError(t *testing.T) {
 	imports := GetTestFunctions(code)
 	expectContentsEqual(t, imports, expected)
 }
+
+
+////////////////////////////////
+// RenameMainFunc
+////////////////////////////////
+
+func expectSourceEqual(t *testing.T, expected string, actual string) {
+	if expected != actual {
+		t.Errorf("Expected:\n---------\n%s\n\nActual:\n---------\n%s", expected, actual)
+	}
+}
+
+func TestRenameMainFuncEmptyFile(t *testing.T) {
+	expectSourceEqual(t, "", RenameMainFunc("", "userMain"))
+}
+
+func TestRenameMainFuncNoMainFunc(t *testing.T) {
+	code := `
+		package main
+
+		func DoSomething() {}
+	`
+
+	expectSourceEqual(t, code, RenameMainFunc(code, "userMain"))
+}
+
+func TestRenameMainFuncSomeResults(t *testing.T) {
+	code := `
+		package main
+
+		import "fmt"
+
+		func DoSomething() {}
+
+		func main() {
+			fmt.Println("main")
+		}
+	`
+	expected := `
+		package main
+
+		import "fmt"
+
+		func DoSomething() {}
+
+		func userMain() {
+			fmt.Println("main")
+		}
+	`
+
+	expectSourceEqual(t, expected, RenameMainFunc(code, "userMain"))
+}
+
+func TestRenameMainFuncIgnoresMethods(t *testing.T) {
+	code := `
+		package main
+
+		type Foo struct {}
+
+		func (f *Foo) main() {}
+	`
+
+	expectSourceEqual(t, code, RenameMainFunc(code, "userMain"))
+}
+
+func TestRenameMainFuncSyntaxError(t *testing.T) {
+	code := `
+		package main
+
+		func main() {
+	`
+
+	expectSourceEqual(t, code, RenameMainFunc(code, "userMain"))
+}
+
+////////////////////////////////
+// RewriteImports
+////////////////////////////////
+
+func TestRewriteImportsNoMatches(t *testing.T) {
+	code := `
+		package foo
+
+		import "./bar"
+	`
+
+	paths := map[string]string{"../bar": "./bar"}
+	expectSourceEqual(t, code, RewriteImports(code, paths))
+}
+
+func TestRewriteImportsSomeResults(t *testing.T) {
+	code := `
+		package foo
+
+		import (
+			"fmt"
+			baz "../baz"
+			"./qux/../bar"
+		)
+
+		import "../baz"
+
+		var x = "../baz"
+	`
+	expected := `
+		package foo
+
+		import (
+			"fmt"
+			baz "./a/baz"
+			"./bar"
+		)
+
+		import "./a/baz"
+
+		var x = "../baz"
+	`
+
+	paths := map[string]string{"../baz": "./a/baz", "./qux/../bar": "./bar"}
+	expectSourceEqual(t, expected, RewriteImports(code, paths))
+}
+
+func TestRewriteImportsSyntaxError(t *testing.T) {
+	code := `
+		package foo
+
+		import (
+			"../baz"
+	`
+
+	paths := map[string]string{"../baz": "./a/baz"}
+	expectSourceEqual(t, code, RewriteImports(code, paths))
+}
+
+////////////////////////////////
+// GetFileInfo
+////////////////////////////////
+
+func TestGetFileInfoEmptyFile(t *testing.T) {
+	info := GetFileInfo("foo.go", "")
+	if info.PackageName != "" || len(info.Imports) != 0 || len(info.TestFuncs) != 0 {
+		t.Errorf("Expected an empty FileInfo, got: %v", info)
+	}
+}
+
+func TestGetFileInfo(t *testing.T) {
+	code := `// Copyright notice.
+
+// +build linux darwin
+// +build amd64
+
+package asdf
+
+import "testing"
+
+func TestBlah(t *testing.T) {}
+func BenchmarkBlah(b *testing.B) {}
+func ExampleBlah() {}
+func DoSomething() {}
+func TestFooBar(t *testing.T) {}
+func (f *Foo) TestMethod(t *testing.T) {}
+`
+	expected := FileInfo{
+		"asdf",
+		[]Import{Import{"testing", "", "foo_test.go", 8, 8, true}},
+		[]string{"TestBlah", "TestFooBar"},
+		[]string{"BenchmarkBlah"},
+		[]string{"ExampleBlah"},
+		[]string{"linux darwin", "amd64"},
+	}
+
+	info := GetFileInfo("foo_test.go", code)
+	if !reflect.DeepEqual(expected, info) {
+		t.Errorf("Expected: %v\nGot: %v", expected, info)
+	}
+}
+
+func TestGetFileInfoSyntaxErrorAfterImports(t *testing.T) {
+	code := `package asdf
+
+import "fmt"
+
+func TestBlah(t *testing.T) {
+`
+	info := GetFileInfo("foo.go", code)
+	if info.PackageName != "asdf" {
+		t.Errorf("Expected package asdf, got: %s", info.PackageName)
+	}
+
+	expectedImports := []Import{Import{"fmt", "", "foo.go", 3, 8, false}}
+	if !reflect.DeepEqual(expectedImports, info.Imports) {
+		t.Errorf("Expected: %v\nGot: %v", expectedImports, info.Imports)
+	}
+
+	if len(info.TestFuncs) != 0 {
+		t.Errorf("Expected no test functions, got: %v", info.TestFuncs)
+	}
+}
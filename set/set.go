@@ -2,48 +2,111 @@
 // See the LICENSE file for licensing details.
 
 // The set package offers an unordered, unique container for strings, like
-// mathematical sets. Currently it is not at all optimized for speed.
+// mathematical sets.
 //
 // TODO(jacobsa): This probably belongs in the built-in container/ package set.
 package set
 
 import (
-	"container/vector"
+	"sort"
 )
 
 // A StringSet is a container of strings whose fundamental operations are
-// insertion and testing for membership.
+// insertion and testing for membership. The zero value is an empty set ready
+// to use.
 type StringSet struct {
-	elements vector.StringVector
+	elements map[string]bool
 }
 
 // Contains returns true or false based on whether the supplied string is in
 // the set.
 func (set *StringSet) Contains(s string) bool {
-	for val := range set.elements.Iter() {
-		if val == s {
-			return true
-		}
-	}
-
-	return false
+	_, ok := set.elements[s]
+	return ok
 }
 
 // Insert adds s to the set, so that Contains(s) will now be true if it wasn't
 // already.
 func (set *StringSet) Insert(s string) {
-	if !set.Contains(s) {
-		set.elements.Push(s)
+	if set.elements == nil {
+		set.elements = make(map[string]bool)
+	}
+
+	set.elements[s] = true
+}
+
+// Remove deletes s from the set, so that Contains(s) will now be false. It
+// does nothing if s isn't in the set.
+func (set *StringSet) Remove(s string) {
+	if set.Contains(s) {
+		set.elements[s] = false, false
 	}
 }
 
+// Len returns the number of elements in the set.
+func (set *StringSet) Len() int { return len(set.elements) }
+
 // Union adds the elements from s to d.
 func (d *StringSet) Union(s *StringSet) {
-	for val := range s.Iter() {
+	for val, _ := range s.elements {
 		d.Insert(val)
 	}
 }
 
+// Intersection removes the elements from d that aren't in s.
+func (d *StringSet) Intersection(s *StringSet) {
+	for val, _ := range d.elements {
+		if !s.Contains(val) {
+			d.Remove(val)
+		}
+	}
+}
+
+// Difference removes the elements in s from d.
+func (d *StringSet) Difference(s *StringSet) {
+	for val, _ := range s.elements {
+		d.Remove(val)
+	}
+}
+
+// Equal returns true if a and b contain the same elements.
+func (a *StringSet) Equal(b *StringSet) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+
+	for val, _ := range a.elements {
+		if !b.Contains(val) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Sorted returns the elements in the set in sorted order, in a new slice.
+func (set *StringSet) Sorted() []string {
+	result := make([]string, set.Len())
+	i := 0
+	for val, _ := range set.elements {
+		result[i] = val
+		i++
+	}
+
+	sort.SortStrings(result)
+	return result
+}
+
 // Iter returns an iterator for the elements in the set. The order of the
-// elements is not guaranteed.
-func (set *StringSet) Iter() <-chan string { return set.elements.Iter() }
+// elements is not guaranteed. The elements are copied when Iter is called, so
+// the set may be modified while iterating, and a loop may stop early without
+// leaking anything.
+func (set *StringSet) Iter() <-chan string {
+	c := make(chan string, set.Len())
+	for val, _ := range set.elements {
+		c <- val
+	}
+
+	close(c)
+	return c
+}
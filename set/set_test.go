@@ -125,3 +125,114 @@ func TestUnion(t *testing.T) {
 		t.Errorf("Expected: %v\nGot: %v", expected2, sorted2)
 	}
 }
+
+func TestLenAndRemove(t *testing.T) {
+	var set StringSet
+	if set.Len() != 0 {
+		t.Errorf("Expected length 0, got: %d", set.Len())
+	}
+
+	set.Remove("foo")
+	set.Insert("foo")
+	set.Insert("bar")
+	set.Insert("foo")
+	if set.Len() != 2 {
+		t.Errorf("Expected length 2, got: %d", set.Len())
+	}
+
+	set.Remove("foo")
+	set.Remove("baz")
+
+	expectDoesntContain(t, &set, "foo")
+	expectContains(t, &set, "bar")
+	if set.Len() != 1 {
+		t.Errorf("Expected length 1, got: %d", set.Len())
+	}
+}
+
+func TestIntersection(t *testing.T) {
+	var set1 StringSet
+	set1.Insert("foo")
+	set1.Insert("bar")
+	set1.Insert("baz")
+
+	var set2 StringSet
+	set2.Insert("foo")
+	set2.Insert("baz")
+	set2.Insert("qux")
+
+	set1.Intersection(&set2)
+
+	sorted := getSorted(&set1)
+	expected := []string{"baz", "foo"}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, sorted)
+	}
+}
+
+func TestDifference(t *testing.T) {
+	var set1 StringSet
+	set1.Insert("foo")
+	set1.Insert("bar")
+	set1.Insert("baz")
+
+	var set2 StringSet
+	set2.Insert("foo")
+	set2.Insert("qux")
+
+	set1.Difference(&set2)
+
+	sorted := getSorted(&set1)
+	expected := []string{"bar", "baz"}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, sorted)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	var set1 StringSet
+	var set2 StringSet
+	if !set1.Equal(&set2) {
+		t.Errorf("Expected empty sets to be equal.")
+	}
+
+	set1.Insert("foo")
+	set1.Insert("bar")
+	set2.Insert("bar")
+	if set1.Equal(&set2) || set2.Equal(&set1) {
+		t.Errorf("Expected %v and %v to differ.", set1.Sorted(), set2.Sorted())
+	}
+
+	set2.Insert("foo")
+	if !set1.Equal(&set2) {
+		t.Errorf("Expected %v and %v to be equal.", set1.Sorted(), set2.Sorted())
+	}
+}
+
+func TestSorted(t *testing.T) {
+	var set StringSet
+	set.Insert("foo")
+	set.Insert("")
+	set.Insert("bar")
+
+	sorted := set.Sorted()
+	expected := []string{"", "bar", "foo"}
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, sorted)
+	}
+}
+
+func TestIterStopsEarly(t *testing.T) {
+	var set StringSet
+	set.Insert("foo")
+	set.Insert("bar")
+
+	for val := range set.Iter() {
+		set.Remove(val)
+		break
+	}
+
+	if set.Len() != 1 {
+		t.Errorf("Expected length 1, got: %d", set.Len())
+	}
+}
@@ -1,40 +1,111 @@
 // Copyright 2010 Aaron Jacobs. All rights reserved.
 // See the LICENSE file for licensing details.
 
-// The test package generates test runner programs for packages.
+// The test package generates test runner programs for packages, and
+// interprets their output.
 package test
 
 import (
-	"container/vector"
 	"fmt"
 	"igo/set"
 )
 
 // GenerateTestMain returns the source code for a test program that will run
-// the specified test functions from the specified package.
-func GenerateTestMain(packageName string, funcs *set.StringSet) string {
-	var funcVec vector.StringVector
-	for val := range funcs.Iter() {
-		funcVec.Push(val)
+// the specified test functions from a package. packageDir is the directory
+// containing the package, relative to the project root (e.g. "bar/baz"), and
+// packageName is the name given in its package clause (e.g. "baz").
+//
+// The package is imported under an alias derived from its name, so the
+// generated code is valid no matter how deeply the package is nested or
+// whether its name matches its directory.
+func GenerateTestMain(packageDir string, packageName string, funcs *set.StringSet) string {
+	alias := importAlias(packageName)
+
+	packageImport := ""
+	if funcs.Len() > 0 {
+		packageImport = fmt.Sprintf("import %s \"./%s\"\n", alias, packageDir)
 	}
 
+	return generateRunner(packageImport, alias+".", funcs)
+}
+
+// GenerateMainPackageTestMain returns the source code for a file that, when
+// compiled together with the files of a package main (with its own main
+// function renamed), runs the specified test functions from that package.
+// Identifiers are prefixed so that they don't collide with the package's own.
+func GenerateMainPackageTestMain(funcs *set.StringSet) string {
+	return generateRunner("", "", funcs)
+}
+
+// importAlias returns the identifier under which the test runner imports the
+// package under test. It is prefixed so that it can't collide with the
+// runner's own identifiers, such as its alias for the testing package.
+func importAlias(packageName string) string {
+	return "igotest_pkg_" + packageName
+}
+
+// generateRunner returns the source for a test runner that imports the
+// package under test with the supplied import declaration (if any), and refers
+// to its test functions with the supplied qualifier. The test functions are
+// listed in sorted order, so that the same source is generated on every run.
+//
+// Each test function is wrapped so that it reports events (see ParseEvent) to
+// standard output when it starts and finishes. After each test the wrapper
+// calls igotest_afterTest, if another file compiled into the runner has set
+// it.
+func generateRunner(packageImport string, qualifier string, funcs *set.StringSet) string {
 	result := ""
 	result += "package main\n\n"
-	result += "import \"testing\"\n"
-
-	if funcVec.Len() > 0 {
-		result += fmt.Sprintf("import \"./%s\"\n\n", packageName)
-	}
+	result += "import igotest_fmt \"fmt\"\n"
+	result += "import igotest_testing \"testing\"\n"
+	result += "import igotest_time \"time\"\n"
+	result += packageImport
+	result += "\n"
 
-	result += "var tests = []testing.Test {\n"
-	for _, val := range funcVec.Data() {
-		result += fmt.Sprintf("\ttesting.Test{\"%s\", %s.%s},\n", val, packageName, val)
+	result += "var igotest_tests = []igotest_testing.Test {\n"
+	for _, val := range funcs.Sorted() {
+		result += fmt.Sprintf(
+			"\tigotest_testing.Test{\"%s\", igotest_wrap(\"%s\", %s%s)},\n",
+			val,
+			val,
+			qualifier,
+			val)
 	}
 
 	result += "}\n\n"
+	result += fmt.Sprintf(runnerSupport, eventPrefix, eventPrefix)
 	result += "func main() {\n"
-	result += "\ttesting.Main(tests)\n"
+	result += "\tigotest_testing.Main(igotest_tests)\n"
 	result += "}\n"
 
 	return result
 }
+
+// runnerSupport is the part of every test runner that reports events. It is
+// a format string taking the event prefix twice.
+const runnerSupport = `var igotest_afterTest func()
+
+func igotest_wrap(name string, f func(*igotest_testing.T)) func(*igotest_testing.T) {
+	return func(t *igotest_testing.T) {
+		igotest_fmt.Printf("%sstart %%s\n", name)
+		start := igotest_time.Nanoseconds()
+
+		defer func() {
+			result := "pass"
+			if t.Failed() {
+				result = "fail"
+			}
+
+			elapsed := igotest_time.Nanoseconds() - start
+			igotest_fmt.Printf("%send %%s %%s %%d\n", name, result, elapsed)
+
+			if igotest_afterTest != nil {
+				igotest_afterTest()
+			}
+		}()
+
+		f(t)
+	}
+}
+
+`
@@ -23,44 +23,135 @@ func expectSourceEqual(t *testing.T, expected string, actual string) {
 	}
 }
 
-func TestEmptySet(t *testing.T) {
-	// If there are no test functions, the test runner shouldn't import the
-	// package.
-	expected :=
-		`package main
+const expectedHeader = `package main
+
+import igotest_fmt "fmt"
+import igotest_testing "testing"
+import igotest_time "time"
+`
+
+const expectedFooter = `var igotest_afterTest func()
+
+func igotest_wrap(name string, f func(*igotest_testing.T)) func(*igotest_testing.T) {
+	return func(t *igotest_testing.T) {
+		igotest_fmt.Printf("--- igo: start %s\n", name)
+		start := igotest_time.Nanoseconds()
 
-import "testing"
-var tests = []testing.Test {
+		defer func() {
+			result := "pass"
+			if t.Failed() {
+				result = "fail"
+			}
+
+			elapsed := igotest_time.Nanoseconds() - start
+			igotest_fmt.Printf("--- igo: end %s %s %d\n", name, result, elapsed)
+
+			if igotest_afterTest != nil {
+				igotest_afterTest()
+			}
+		}()
+
+		f(t)
+	}
 }
 
 func main() {
-	testing.Main(tests)
+	igotest_testing.Main(igotest_tests)
 }
 `
-	actual := GenerateTestMain("blah", createSet([]string{}))
-	expectSourceEqual(t, expected, actual)
-}
 
-func TestNonEmptySet(t *testing.T) {
+func TestEmptySet(t *testing.T) {
 	// If there are no test functions, the test runner shouldn't import the
 	// package.
-	expected :=
-		`package main
+	expected := expectedHeader + `
+var igotest_tests = []igotest_testing.Test {
+}
 
-import "testing"
-import "./blah"
+` + expectedFooter
 
-var tests = []testing.Test {
-	testing.Test{"TestFoo", blah.TestFoo},
-	testing.Test{"TestBar", blah.TestBar},
-	testing.Test{"TestBaz", blah.TestBaz},
+	actual := GenerateTestMain("blah", "blah", createSet([]string{}))
+	expectSourceEqual(t, expected, actual)
 }
 
-func main() {
-	testing.Main(tests)
+func TestNonEmptySet(t *testing.T) {
+	expected := expectedHeader + `import igotest_pkg_blah "./blah"
+
+var igotest_tests = []igotest_testing.Test {
+	igotest_testing.Test{"TestBar", igotest_wrap("TestBar", igotest_pkg_blah.TestBar)},
+	igotest_testing.Test{"TestBaz", igotest_wrap("TestBaz", igotest_pkg_blah.TestBaz)},
+	igotest_testing.Test{"TestFoo", igotest_wrap("TestFoo", igotest_pkg_blah.TestFoo)},
 }
-`
+
+` + expectedFooter
+
 	funcs := createSet([]string{"TestFoo", "TestBar", "TestBaz"})
-	actual := GenerateTestMain("blah", funcs)
+	actual := GenerateTestMain("blah", "blah", funcs)
+	expectSourceEqual(t, expected, actual)
+}
+
+func TestNestedPackage(t *testing.T) {
+	expected := expectedHeader + `import igotest_pkg_baz "./bar/baz"
+
+var igotest_tests = []igotest_testing.Test {
+	igotest_testing.Test{"TestDoStuff", igotest_wrap("TestDoStuff", igotest_pkg_baz.TestDoStuff)},
+}
+
+` + expectedFooter
+
+	funcs := createSet([]string{"TestDoStuff"})
+	actual := GenerateTestMain("bar/baz", "baz", funcs)
+	expectSourceEqual(t, expected, actual)
+}
+
+func TestPackageNameDiffersFromDirectory(t *testing.T) {
+	expected := expectedHeader + `import igotest_pkg_qwerty "./foo/bar-v2"
+
+var igotest_tests = []igotest_testing.Test {
+	igotest_testing.Test{"TestFoo", igotest_wrap("TestFoo", igotest_pkg_qwerty.TestFoo)},
+}
+
+` + expectedFooter
+
+	funcs := createSet([]string{"TestFoo"})
+	actual := GenerateTestMain("foo/bar-v2", "qwerty", funcs)
+	expectSourceEqual(t, expected, actual)
+}
+
+func TestPackageNamedTesting(t *testing.T) {
+	expected := expectedHeader + `import igotest_pkg_testing "./testing"
+
+var igotest_tests = []igotest_testing.Test {
+	igotest_testing.Test{"TestFoo", igotest_wrap("TestFoo", igotest_pkg_testing.TestFoo)},
+}
+
+` + expectedFooter
+
+	funcs := createSet([]string{"TestFoo"})
+	actual := GenerateTestMain("testing", "testing", funcs)
+	expectSourceEqual(t, expected, actual)
+}
+
+func TestMainPackageEmptySet(t *testing.T) {
+	expected := expectedHeader + `
+var igotest_tests = []igotest_testing.Test {
+}
+
+` + expectedFooter
+
+	actual := GenerateMainPackageTestMain(createSet([]string{}))
+	expectSourceEqual(t, expected, actual)
+}
+
+func TestMainPackageNonEmptySet(t *testing.T) {
+	expected := expectedHeader + `
+var igotest_tests = []igotest_testing.Test {
+	igotest_testing.Test{"TestBar", igotest_wrap("TestBar", TestBar)},
+	igotest_testing.Test{"TestFoo", igotest_wrap("TestFoo", TestFoo)},
+}
+
+` + expectedFooter
+
+	funcs := createSet([]string{"TestFoo", "TestBar"})
+	actual := GenerateMainPackageTestMain(funcs)
 	expectSourceEqual(t, expected, actual)
 }
@@ -0,0 +1,316 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package test
+
+import (
+	"bytes"
+	"container/vector"
+	"fmt"
+	"igo/set"
+	"strings"
+)
+
+// A TestResult describes the outcome of running a single test function.
+type TestResult struct {
+	Package string
+	Name    string
+
+	// One of "pass", "fail", or "skip".
+	Status string
+
+	// How long the test took, in nanoseconds.
+	Elapsed int64
+
+	// Everything the runner printed between the start of this test and the
+	// start of the next, including failure messages.
+	Output string
+}
+
+// A ResultCollector interprets the output of a test runner generated by
+// GenerateTestMain, line by line, and gathers the results of its tests.
+type ResultCollector struct {
+	// The package whose test runner is being interpreted.
+	Package string
+
+	// If non-nil, OnEvent is called with "start" when a test starts, with
+	// "pass" or "fail" once the test's result and output are complete, and with
+	// "skip" for tests that never ran.
+	OnEvent func(action string, result *TestResult)
+
+	// Output that doesn't belong to any test.
+	Output string
+
+	results vector.Vector // Of *TestResult, in the order that they started.
+	started set.StringSet
+	current *TestResult // The most recently started test, if any.
+}
+
+// AddLine interprets a line of output from the runner, including its trailing
+// newline if any, and returns the part of it that is output rather than the
+// report of an event. An event is recognised even if it follows output on the
+// same line, as happens when a test prints something without a trailing
+// newline. That output is then treated as a line of its own.
+func (c *ResultCollector) AddLine(line string) (output string) {
+	index := strings.Index(line, eventPrefix)
+	if index < 0 {
+		c.addOutput(line)
+		return line
+	}
+
+	event, ok := ParseEvent(strings.TrimSpace(line[index:]))
+	if !ok {
+		c.addOutput(line)
+		return line
+	}
+
+	if index > 0 {
+		output = line[0:index] + "\n"
+		c.addOutput(output)
+	}
+
+	switch event.Kind {
+	case "start":
+		c.completeCurrent()
+		c.current = &TestResult{Package: c.Package, Name: event.Name}
+		c.results.Push(c.current)
+		c.started.Insert(event.Name)
+		c.emit("start", c.current)
+
+	case "end":
+		if c.current != nil && c.current.Name == event.Name {
+			c.current.Elapsed = event.Elapsed
+			c.current.Status = "fail"
+			if event.Passed {
+				c.current.Status = "pass"
+			}
+		}
+	}
+
+	return output
+}
+
+func (c *ResultCollector) addOutput(line string) {
+	// The runner's overall verdict isn't part of the last test's output.
+	verdict := strings.TrimSpace(line)
+	if c.current == nil || verdict == "PASS" || verdict == "FAIL" {
+		c.Output += line
+		return
+	}
+
+	c.current.Output += line
+}
+
+// Running returns the name of the test that has started but not finished, or
+// the empty string if there is none.
+func (c *ResultCollector) Running() string {
+	if c.current != nil && c.current.Status == "" {
+		return c.current.Name
+	}
+
+	return ""
+}
+
+// completeCurrent reports the result of the current test, if any. A test that
+// never finished, for example because the runner crashed, has failed.
+func (c *ResultCollector) completeCurrent() {
+	if c.current == nil {
+		return
+	}
+
+	if c.current.Status == "" {
+		c.current.Status = "fail"
+	}
+
+	c.emit(c.current.Status, c.current)
+	c.current = nil
+}
+
+func (c *ResultCollector) emit(action string, result *TestResult) {
+	if c.OnEvent != nil {
+		c.OnEvent(action, result)
+	}
+}
+
+// Finish is called once the runner has exited. funcs must contain the names
+// of all of the package's test functions; those that never started are
+// reported as skipped. It returns the results of all of the tests.
+func (c *ResultCollector) Finish(funcs []string) []TestResult {
+	c.completeCurrent()
+
+	for _, name := range funcs {
+		if !c.started.Contains(name) {
+			result := &TestResult{Package: c.Package, Name: name, Status: "skip"}
+			c.results.Push(result)
+			c.started.Insert(name)
+			c.emit("skip", result)
+		}
+	}
+
+	results := make([]TestResult, c.results.Len())
+	for i := range results {
+		results[i] = *c.results.At(i).(*TestResult)
+	}
+
+	return results
+}
+
+// FormatJSONEvent returns a single line of JSON describing an event for the
+// supplied test, as reported by ResultCollector.OnEvent. The elapsed time (in
+// seconds) and output are included only for "pass" and "fail" events.
+func FormatJSONEvent(action string, result *TestResult) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "{\"Action\":%s", JSONQuote(action))
+	fmt.Fprintf(&buf, ",\"Package\":%s", JSONQuote(result.Package))
+	fmt.Fprintf(&buf, ",\"Test\":%s", JSONQuote(result.Name))
+
+	if action == "pass" || action == "fail" {
+		fmt.Fprintf(&buf, ",\"Elapsed\":%.3f", float64(result.Elapsed)/1e9)
+		fmt.Fprintf(&buf, ",\"Output\":%s", JSONQuote(result.Output))
+	}
+
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// FormatJSONPackageEvent returns a single line of JSON describing the overall
+// result ("pass" or "fail") of testing a package, along with any output that
+// didn't belong to a particular test.
+func FormatJSONPackageEvent(action string, packageName string, output string) string {
+	return fmt.Sprintf(
+		"{\"Action\":%s,\"Package\":%s,\"Output\":%s}",
+		JSONQuote(action),
+		JSONQuote(packageName),
+		JSONQuote(output))
+}
+
+// jsonQuote returns s as a JSON string literal. s is assumed to be UTF-8.
+func JSONQuote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteString("\"")
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			buf.WriteString("\\\"")
+		case c == '\\':
+			buf.WriteString("\\\\")
+		case c == '\n':
+			buf.WriteString("\\n")
+		case c == '\t':
+			buf.WriteString("\\t")
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&buf, "\\u%04x", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	buf.WriteString("\"")
+	return buf.String()
+}
+
+// FormatJUnit returns a JUnit XML report for the supplied results, with one
+// test suite per package in the order in which the packages first appear.
+func FormatJUnit(results []TestResult) string {
+	var packages vector.StringVector
+	byPackage := make(map[string]*vector.Vector)
+
+	for i := range results {
+		suite, ok := byPackage[results[i].Package]
+		if !ok {
+			suite = new(vector.Vector)
+			byPackage[results[i].Package] = suite
+			packages.Push(results[i].Package)
+		}
+
+		suite.Push(&results[i])
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	buf.WriteString("<testsuites>\n")
+
+	for _, packageName := range packages.Data() {
+		suite := byPackage[packageName]
+
+		failures := 0
+		skipped := 0
+		var elapsed int64
+		for i := 0; i < suite.Len(); i++ {
+			result := suite.At(i).(*TestResult)
+			elapsed += result.Elapsed
+			switch result.Status {
+			case "fail":
+				failures++
+			case "skip":
+				skipped++
+			}
+		}
+
+		fmt.Fprintf(
+			&buf,
+			"  <testsuite name=\"%s\" tests=\"%d\" failures=\"%d\" skipped=\"%d\" time=\"%.3f\">\n",
+			xmlEscape(packageName),
+			suite.Len(),
+			failures,
+			skipped,
+			float64(elapsed)/1e9)
+
+		for i := 0; i < suite.Len(); i++ {
+			result := suite.At(i).(*TestResult)
+			fmt.Fprintf(
+				&buf,
+				"    <testcase classname=\"%s\" name=\"%s\" time=\"%.3f\"",
+				xmlEscape(packageName),
+				xmlEscape(result.Name),
+				float64(result.Elapsed)/1e9)
+
+			switch result.Status {
+			case "fail":
+				buf.WriteString(">\n")
+				fmt.Fprintf(&buf, "      <failure message=\"Failed\">%s</failure>\n", xmlEscape(result.Output))
+				buf.WriteString("    </testcase>\n")
+			case "skip":
+				buf.WriteString(">\n")
+				buf.WriteString("      <skipped/>\n")
+				buf.WriteString("    </testcase>\n")
+			default:
+				buf.WriteString("/>\n")
+			}
+		}
+
+		buf.WriteString("  </testsuite>\n")
+	}
+
+	buf.WriteString("</testsuites>\n")
+	return buf.String()
+}
+
+// xmlEscape escapes s for use in XML text or attribute values. Control
+// characters, which XML 1.0 can't represent, are dropped.
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '&':
+			buf.WriteString("&amp;")
+		case c == '<':
+			buf.WriteString("&lt;")
+		case c == '>':
+			buf.WriteString("&gt;")
+		case c == '"':
+			buf.WriteString("&quot;")
+		case c == '\'':
+			buf.WriteString("&apos;")
+		case c < 0x20 && c != '\n' && c != '\t' && c != '\r':
+			// Dropped.
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
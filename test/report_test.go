@@ -0,0 +1,232 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package test
+
+import (
+	"container/vector"
+	"reflect"
+	"testing"
+)
+
+////////////////////////////////
+// ResultCollector
+////////////////////////////////
+
+func collect(lines []string, funcs []string) (*ResultCollector, []TestResult, []string) {
+	var events vector.StringVector
+	collector := &ResultCollector{Package: "foo"}
+	collector.OnEvent = func(action string, result *TestResult) {
+		events.Push(action + " " + result.Name)
+	}
+
+	for _, line := range lines {
+		collector.AddLine(line)
+	}
+
+	results := collector.Finish(funcs)
+	return collector, results, events.Data()
+}
+
+func expectResults(t *testing.T, expected []TestResult, actual []TestResult) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected: %v\nGot: %v", expected, actual)
+	}
+}
+
+func expectEvents(t *testing.T, expected []string, actual []string) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected: %v\nGot: %v", expected, actual)
+	}
+}
+
+func TestCollectorNoOutput(t *testing.T) {
+	_, results, events := collect([]string{}, []string{})
+	expectResults(t, []TestResult{}, results)
+	expectEvents(t, []string{}, events)
+}
+
+func TestCollectorPassAndFail(t *testing.T) {
+	lines := []string{
+		"--- igo: start TestA\n",
+		"Returning 9.\n",
+		"--- igo: end TestA pass 100\n",
+		"--- igo: start TestB\n",
+		"--- igo: end TestB fail 200\n",
+		"--- FAIL: TestB\n",
+		"\tfoo_test.go:10: Expected nine.\n",
+		"FAIL\n",
+	}
+
+	collector, results, events := collect(lines, []string{"TestA", "TestB"})
+
+	expectResults(
+		t,
+		[]TestResult{
+			TestResult{"foo", "TestA", "pass", 100, "Returning 9.\n"},
+			TestResult{"foo", "TestB", "fail", 200, "--- FAIL: TestB\n\tfoo_test.go:10: Expected nine.\n"},
+		},
+		results)
+
+	expectEvents(t, []string{"start TestA", "pass TestA", "start TestB", "fail TestB"}, events)
+
+	if collector.Output != "FAIL\n" {
+		t.Errorf("Expected package output FAIL, got: %s", collector.Output)
+	}
+}
+
+func TestCollectorSkippedTests(t *testing.T) {
+	lines := []string{
+		"--- igo: start TestB\n",
+		"--- igo: end TestB pass 5\n",
+		"PASS\n",
+	}
+
+	_, results, events := collect(lines, []string{"TestA", "TestB", "TestC"})
+
+	expectResults(
+		t,
+		[]TestResult{
+			TestResult{"foo", "TestB", "pass", 5, ""},
+			TestResult{"foo", "TestA", "skip", 0, ""},
+			TestResult{"foo", "TestC", "skip", 0, ""},
+		},
+		results)
+
+	expectEvents(t, []string{"start TestB", "pass TestB", "skip TestA", "skip TestC"}, events)
+}
+
+func TestCollectorUnfinishedTest(t *testing.T) {
+	var collector ResultCollector
+	collector.Package = "foo"
+
+	collector.AddLine("--- igo: start TestA\n")
+	collector.AddLine("--- igo: end TestA pass 5\n")
+	if collector.Running() != "" {
+		t.Errorf("Expected no running test, got: %s", collector.Running())
+	}
+
+	collector.AddLine("--- igo: start TestB\n")
+	collector.AddLine("SIGQUIT: quit\n")
+	if collector.Running() != "TestB" {
+		t.Errorf("Expected TestB running, got: %s", collector.Running())
+	}
+
+	expectResults(
+		t,
+		[]TestResult{
+			TestResult{"foo", "TestA", "pass", 5, ""},
+			TestResult{"foo", "TestB", "fail", 0, "SIGQUIT: quit\n"},
+		},
+		collector.Finish([]string{"TestA", "TestB"}))
+}
+
+func TestCollectorAddLineReturnValue(t *testing.T) {
+	var collector ResultCollector
+	expectSourceEqual(t, "", collector.AddLine("--- igo: start TestA\n"))
+	expectSourceEqual(t, "some output\n", collector.AddLine("some output\n"))
+	expectSourceEqual(t, "no newline\n", collector.AddLine("no newline--- igo: end TestA pass 5\n"))
+}
+
+func TestCollectorOutputWithoutTrailingNewline(t *testing.T) {
+	lines := []string{
+		"--- igo: start TestA\n",
+		"Returning 9.--- igo: end TestA pass 100\n",
+		"--- igo: start TestB\n",
+		"partial--- igo: end TestB fail 200\n",
+		"--- igo: start TestC\n",
+		"--- igo: end TestC pass 300\n",
+		"PASS\n",
+	}
+
+	collector, results, events := collect(lines, []string{"TestA", "TestB", "TestC"})
+	expectResults(
+		t,
+		[]TestResult{
+			TestResult{"foo", "TestA", "pass", 100, "Returning 9.\n"},
+			TestResult{"foo", "TestB", "fail", 200, "partial\n"},
+			TestResult{"foo", "TestC", "pass", 300, ""},
+		},
+		results)
+
+	expectEvents(
+		t,
+		[]string{
+			"start TestA", "pass TestA",
+			"start TestB", "fail TestB",
+			"start TestC", "pass TestC",
+		},
+		events)
+
+	expectSourceEqual(t, "PASS\n", collector.Output)
+}
+
+////////////////////////////////
+// JSON
+////////////////////////////////
+
+func TestJSONQuote(t *testing.T) {
+	expectSourceEqual(t, `"a \"b\" \\ \n\t\u0007"`, JSONQuote("a \"b\" \\ \n\t\x07"))
+}
+
+func TestFormatJSONEventStart(t *testing.T) {
+	result := &TestResult{Package: "bar/baz", Name: "TestA"}
+	expectSourceEqual(
+		t,
+		`{"Action":"start","Package":"bar/baz","Test":"TestA"}`,
+		FormatJSONEvent("start", result))
+}
+
+func TestFormatJSONEventFail(t *testing.T) {
+	result := &TestResult{"foo", "TestA", "fail", 1500000000, "line \"1\"\n\tline\\2\x01"}
+	expectSourceEqual(
+		t,
+		`{"Action":"fail","Package":"foo","Test":"TestA","Elapsed":1.500,`+
+			`"Output":"line \"1\"\n\tline\\2\u0001"}`,
+		FormatJSONEvent("fail", result))
+}
+
+func TestFormatJSONPackageEvent(t *testing.T) {
+	expectSourceEqual(
+		t,
+		`{"Action":"pass","Package":"foo","Output":"PASS\n"}`,
+		FormatJSONPackageEvent("pass", "foo", "PASS\n"))
+}
+
+////////////////////////////////
+// JUnit
+////////////////////////////////
+
+func TestFormatJUnitEmpty(t *testing.T) {
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+</testsuites>
+`
+	expectSourceEqual(t, expected, FormatJUnit([]TestResult{}))
+}
+
+func TestFormatJUnit(t *testing.T) {
+	results := []TestResult{
+		TestResult{"foo", "TestA", "pass", 1000000, "ignored"},
+		TestResult{"bar/baz", "TestB", "fail", 2000000, "a < b & \"c\"\n"},
+		TestResult{"foo", "TestC", "skip", 0, ""},
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="foo" tests="2" failures="0" skipped="1" time="0.001">
+    <testcase classname="foo" name="TestA" time="0.001"/>
+    <testcase classname="foo" name="TestC" time="0.000">
+      <skipped/>
+    </testcase>
+  </testsuite>
+  <testsuite name="bar/baz" tests="1" failures="1" skipped="0" time="0.002">
+    <testcase classname="bar/baz" name="TestB" time="0.002">
+      <failure message="Failed">a &lt; b &amp; &quot;c&quot;
+</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	expectSourceEqual(t, expected, FormatJUnit(results))
+}
@@ -0,0 +1,109 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package test
+
+import (
+	"container/vector"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// eventPrefix begins every line of test runner output that reports an event.
+const eventPrefix = "--- igo: "
+
+// An Event is a report from a running test runner generated by
+// GenerateTestMain that a test function has started or finished.
+type Event struct {
+	// Either "start" or "end".
+	Kind string
+
+	// The name of the test function.
+	Name string
+
+	// For "end" events, whether the test passed and how long it took in
+	// nanoseconds.
+	Passed  bool
+	Elapsed int64
+}
+
+// ParseEvent parses a line of output from a test runner, not including the
+// trailing newline. It returns false if the line doesn't report an event.
+func ParseEvent(line string) (event Event, ok bool) {
+	if !strings.HasPrefix(line, eventPrefix) {
+		return
+	}
+
+	fields := splitFields(line[len(eventPrefix):])
+	switch {
+	case len(fields) == 2 && fields[0] == "start":
+		return Event{Kind: "start", Name: fields[1]}, true
+
+	case len(fields) == 4 && fields[0] == "end":
+		elapsed, err := strconv.Atoi64(fields[3])
+		if err != nil || (fields[2] != "pass" && fields[2] != "fail") {
+			return
+		}
+
+		return Event{"end", fields[1], fields[2] == "pass", elapsed}, true
+	}
+
+	return
+}
+
+// splitFields splits s around runs of spaces.
+func splitFields(s string) []string {
+	var result vector.StringVector
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			break
+		}
+
+		end := strings.Index(s, " ")
+		if end < 0 {
+			end = len(s)
+		}
+
+		result.Push(s[0:end])
+		s = s[end:]
+	}
+
+	return result.Data()
+}
+
+// A TestTiming records how long a test function took to run.
+type TestTiming struct {
+	Name    string
+	Elapsed int64 // In nanoseconds
+}
+
+// SlowestTests returns up to n of the supplied timings, slowest first. Tests
+// that took equally long are ordered by name.
+func SlowestTests(timings []TestTiming, n int) []TestTiming {
+	sorted := timingList(make([]TestTiming, len(timings)))
+	for i, val := range timings {
+		sorted[i] = val
+	}
+
+	sort.Sort(sorted)
+	if n < len(sorted) {
+		return sorted[0:n]
+	}
+
+	return sorted
+}
+
+type timingList []TestTiming
+
+func (l timingList) Len() int      { return len(l) }
+func (l timingList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func (l timingList) Less(i, j int) bool {
+	if l[i].Elapsed != l[j].Elapsed {
+		return l[i].Elapsed > l[j].Elapsed
+	}
+
+	return l[i].Name < l[j].Name
+}
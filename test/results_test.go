@@ -0,0 +1,113 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package test
+
+import (
+	"reflect"
+	"testing"
+)
+
+////////////////////////////////
+// ParseEvent
+////////////////////////////////
+
+func expectNoEvent(t *testing.T, line string) {
+	if event, ok := ParseEvent(line); ok {
+		t.Errorf("Expected no event for [%s], got: %v", line, event)
+	}
+}
+
+func expectEvent(t *testing.T, line string, expected Event) {
+	event, ok := ParseEvent(line)
+	if !ok {
+		t.Errorf("Expected an event for [%s]", line)
+	} else if !reflect.DeepEqual(event, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, event)
+	}
+}
+
+func TestParseEventOrdinaryOutput(t *testing.T) {
+	expectNoEvent(t, "")
+	expectNoEvent(t, "PASS")
+	expectNoEvent(t, "--- FAIL: TestFoo")
+	expectNoEvent(t, "Returning 9.")
+}
+
+func TestParseEventMalformed(t *testing.T) {
+	expectNoEvent(t, "--- igo: ")
+	expectNoEvent(t, "--- igo: start")
+	expectNoEvent(t, "--- igo: finish TestFoo")
+	expectNoEvent(t, "--- igo: end TestFoo pass")
+	expectNoEvent(t, "--- igo: end TestFoo maybe 17")
+	expectNoEvent(t, "--- igo: end TestFoo pass seventeen")
+}
+
+func TestParseEventStart(t *testing.T) {
+	expectEvent(t, "--- igo: start TestFoo", Event{Kind: "start", Name: "TestFoo"})
+}
+
+func TestParseEventEnd(t *testing.T) {
+	expectEvent(
+		t,
+		"--- igo: end TestFoo pass 1234",
+		Event{Kind: "end", Name: "TestFoo", Passed: true, Elapsed: 1234})
+
+	expectEvent(
+		t,
+		"--- igo: end TestBar fail 17",
+		Event{Kind: "end", Name: "TestBar", Passed: false, Elapsed: 17})
+}
+
+////////////////////////////////
+// SlowestTests
+////////////////////////////////
+
+func TestSlowestTestsEmpty(t *testing.T) {
+	result := SlowestTests([]TestTiming{}, 5)
+	if len(result) != 0 {
+		t.Errorf("Expected empty, got: %v", result)
+	}
+}
+
+func TestSlowestTests(t *testing.T) {
+	timings := []TestTiming{
+		TestTiming{"TestA", 10},
+		TestTiming{"TestB", 30},
+		TestTiming{"TestC", 20},
+		TestTiming{"TestD", 30},
+	}
+
+	expected := []TestTiming{
+		TestTiming{"TestB", 30},
+		TestTiming{"TestD", 30},
+		TestTiming{"TestC", 20},
+	}
+
+	result := SlowestTests(timings, 3)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, result)
+	}
+
+	// The input shouldn't be modified.
+	if timings[0].Name != "TestA" {
+		t.Errorf("Input was modified: %v", timings)
+	}
+}
+
+func TestSlowestTestsFewerThanRequested(t *testing.T) {
+	timings := []TestTiming{
+		TestTiming{"TestA", 10},
+		TestTiming{"TestB", 30},
+	}
+
+	expected := []TestTiming{
+		TestTiming{"TestB", 30},
+		TestTiming{"TestA", 10},
+	}
+
+	result := SlowestTests(timings, 5)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected: %v\nGot: %v", expected, result)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+// The trace package records how long the steps of a build take, finds the
+// critical path through a build, and exports traces for viewing.
+package trace
+
+import (
+	"bytes"
+	"container/vector"
+	"fmt"
+	"igo/set"
+	"igo/test"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Step is a timed step of a build, such as scanning, compiling or linking a
+// package, or running a test runner.
+type Step struct {
+	Kind   string // For example "compile" or "link".
+	Target string // The package or test runner that the step is for.
+
+	// Steps may run concurrently on different threads, but not on the same one.
+	Thread int
+
+	// The start and end of the step, in nanoseconds since the epoch.
+	Start int64
+	End   int64
+}
+
+// Duration returns the length of the step in nanoseconds.
+func (s *Step) Duration() int64 { return s.End - s.Start }
+
+// A Recorder collects the steps of a build. It may be used by multiple
+// goroutines at once. The zero value is ready to use.
+type Recorder struct {
+	mutex sync.Mutex
+	steps vector.Vector // Of Step
+}
+
+// Start returns a step of the supplied kind for the supplied target, starting
+// now. It is recorded when passed to Finish.
+func (r *Recorder) Start(kind string, target string, thread int) *Step {
+	return &Step{kind, target, thread, time.Nanoseconds(), 0}
+}
+
+// Finish ends the supplied step now, and records it.
+func (r *Recorder) Finish(s *Step) {
+	s.End = time.Nanoseconds()
+
+	r.mutex.Lock()
+	r.steps.Push(*s)
+	r.mutex.Unlock()
+}
+
+// Steps returns the steps recorded so far, in order of their start time.
+func (r *Recorder) Steps() []Step {
+	var list stepList
+	r.mutex.Lock()
+	for i := 0; i < r.steps.Len(); i++ {
+		list.Push(r.steps.At(i))
+	}
+	r.mutex.Unlock()
+
+	sort.Sort(&list)
+
+	result := make([]Step, list.Len())
+	for i := range result {
+		result[i] = list.At(i).(Step)
+	}
+
+	return result
+}
+
+// stepList is a list of Steps sortable by start time.
+type stepList struct {
+	vector.Vector
+}
+
+func (l *stepList) Less(i, j int) bool {
+	return l.At(i).(Step).Start < l.At(j).(Step).Start
+}
+
+// Durations returns the total duration of the supplied steps of each target,
+// keyed by target and then by kind of step.
+func Durations(steps []Step) map[string]map[string]int64 {
+	result := make(map[string]map[string]int64)
+	for i := range steps {
+		byKind, ok := result[steps[i].Target]
+		if !ok {
+			byKind = make(map[string]int64)
+			result[steps[i].Target] = byKind
+		}
+
+		byKind[steps[i].Kind] += steps[i].Duration()
+	}
+
+	return result
+}
+
+// CriticalPath returns the chain of packages through the supplied dependency
+// graph whose durations sum to the most, and that sum. order must contain every
+// package in deps, with each package after its dependencies, as returned by
+// deps.BuildTotalOrder. The path is listed dependencies first, and ties are
+// broken in favour of the package that comes first in order.
+func CriticalPath(
+	durations map[string]int64,
+	order []string,
+	deps map[string]*set.StringSet) (path []string, total int64) {
+	// The length of the longest chain ending with each package, and the
+	// previous package on that chain.
+	longest := make(map[string]int64)
+	previous := make(map[string]string)
+
+	last := ""
+	for _, packageName := range order {
+		best := ""
+		if packageDeps, ok := deps[packageName]; ok {
+			for _, dep := range packageDeps.Sorted() {
+				if _, ok := longest[dep]; !ok {
+					continue
+				}
+
+				if best == "" || longest[dep] > longest[best] {
+					best = dep
+				}
+			}
+		}
+
+		longest[packageName] = durations[packageName]
+		if best != "" {
+			longest[packageName] += longest[best]
+			previous[packageName] = best
+		}
+
+		if last == "" || longest[packageName] > longest[last] {
+			last = packageName
+		}
+	}
+
+	if last == "" {
+		return []string{}, 0
+	}
+
+	var reversed vector.StringVector
+	for packageName := last; packageName != ""; packageName = previous[packageName] {
+		reversed.Push(packageName)
+	}
+
+	path = make([]string, reversed.Len())
+	for i := range path {
+		path[i] = reversed.At(reversed.Len() - 1 - i)
+	}
+
+	return path, longest[last]
+}
+
+// FormatChromeTrace returns the supplied steps in the trace event format read
+// by Chrome's trace viewer, with times relative to the supplied start time.
+func FormatChromeTrace(steps []Step, start int64) string {
+	var buf bytes.Buffer
+	buf.WriteString("{\"traceEvents\":[")
+
+	for i := range steps {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		fmt.Fprintf(
+			&buf,
+			"\n{\"name\":%s,\"cat\":%s,\"ph\":\"X\",\"pid\":1,\"tid\":%d,"+
+				"\"ts\":%d,\"dur\":%d,\"args\":{\"target\":%s}}",
+			test.JSONQuote(steps[i].Kind+" "+steps[i].Target),
+			test.JSONQuote(steps[i].Kind),
+			steps[i].Thread,
+			(steps[i].Start-start)/1000,
+			steps[i].Duration()/1000,
+			test.JSONQuote(steps[i].Target))
+	}
+
+	buf.WriteString("\n]}\n")
+	return buf.String()
+}
@@ -0,0 +1,118 @@
+// Copyright 2010 Aaron Jacobs. All rights reserved.
+// See the LICENSE file for licensing details.
+
+package trace
+
+import (
+	"igo/set"
+	"reflect"
+	"testing"
+)
+
+func createDeps(deps map[string]*set.StringSet, name string, names []string) {
+	s := &set.StringSet{}
+	for _, val := range names {
+		s.Insert(val)
+	}
+
+	deps[name] = s
+}
+
+func TestRecorder(t *testing.T) {
+	var r Recorder
+	first := r.Start("compile", "foo", 0)
+	second := r.Start("scan", "bar", 1)
+	r.Finish(second)
+	r.Finish(first)
+
+	steps := r.Steps()
+	if len(steps) != 2 {
+		t.Fatalf("Expected two steps, got: %v", steps)
+	}
+
+	if steps[0].Kind != "compile" || steps[0].Target != "foo" || steps[1].Thread != 1 {
+		t.Errorf("Unexpected steps: %v", steps)
+	}
+
+	if steps[0].Start > steps[1].Start || steps[0].End < steps[0].Start {
+		t.Errorf("Unexpected times: %v", steps)
+	}
+}
+
+func TestDurations(t *testing.T) {
+	steps := []Step{
+		Step{"compile", "foo", 0, 10, 15},
+		Step{"pack", "foo", 0, 15, 17},
+		Step{"compile", "bar", 0, 20, 30},
+		Step{"compile", "foo", 0, 40, 41},
+	}
+
+	expected := map[string]map[string]int64{
+		"foo": map[string]int64{"compile": 6, "pack": 2},
+		"bar": map[string]int64{"compile": 10},
+	}
+
+	durations := Durations(steps)
+	if !reflect.DeepEqual(expected, durations) {
+		t.Errorf("Expected: %v\nGot: %v", expected, durations)
+	}
+}
+
+func TestCriticalPathEmpty(t *testing.T) {
+	path, total := CriticalPath(
+		map[string]int64{},
+		[]string{},
+		make(map[string]*set.StringSet))
+
+	if len(path) != 0 || total != 0 {
+		t.Errorf("Expected an empty path, got: %v (%d)", path, total)
+	}
+}
+
+func TestCriticalPath(t *testing.T) {
+	deps := make(map[string]*set.StringSet)
+	createDeps(deps, "baz", []string{"fmt"})
+	createDeps(deps, "foo", []string{"baz"})
+	createDeps(deps, "qux", []string{})
+	createDeps(deps, "bar", []string{"foo", "qux"})
+	createDeps(deps, "tony", []string{"baz"})
+
+	durations := map[string]int64{
+		"baz":  3,
+		"foo":  2,
+		"qux":  4,
+		"bar":  1,
+		"tony": 1,
+	}
+
+	order := []string{"baz", "foo", "qux", "bar", "tony"}
+	path, total := CriticalPath(durations, order, deps)
+
+	expectedPath := []string{"baz", "foo", "bar"}
+	if !reflect.DeepEqual(expectedPath, path) {
+		t.Errorf("Expected: %v\nGot: %v", expectedPath, path)
+	}
+
+	if total != 6 {
+		t.Errorf("Expected total 6, got: %d", total)
+	}
+}
+
+func TestFormatChromeTrace(t *testing.T) {
+	steps := []Step{
+		Step{"compile", "foo", 0, 1000000, 3000000},
+		Step{"scan", "b\"ar", 2, 1500000, 1600000},
+	}
+
+	expected := "{\"traceEvents\":[\n" +
+		"{\"name\":\"compile foo\",\"cat\":\"compile\",\"ph\":\"X\",\"pid\":1," +
+		"\"tid\":0,\"ts\":0,\"dur\":2000,\"args\":{\"target\":\"foo\"}},\n" +
+		"{\"name\":\"scan b\\\"ar\",\"cat\":\"scan\",\"ph\":\"X\",\"pid\":1," +
+		"\"tid\":2,\"ts\":500,\"dur\":100,\"args\":{\"target\":\"b\\\"ar\"}}\n" +
+		"]}\n"
+
+	actual := FormatChromeTrace(steps, 1000000)
+	if actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+}